@@ -0,0 +1,449 @@
+/*
+Package apply reconciles the children of an owner object to a desired set of objects of any kind: missing children are
+created, children that differ from the desired state are patched and children that are no longer desired are deleted.
+*/
+package apply
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/rancher/lasso/pkg/cache"
+	"github.com/rancher/lasso/pkg/client"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+const (
+	// LabelOwnerHash is set on every applied child, identifying its owner
+	LabelOwnerHash = "apply.lasso.cattle.io/owner-hash"
+	// AnnotationOwner is set on every applied child, holding the kind, namespace and name of its owner
+	AnnotationOwner = "apply.lasso.cattle.io/owner"
+	// AnnotationLastApplied holds the configuration last applied to a child, used to compute three-way patches
+	AnnotationLastApplied = "apply.lasso.cattle.io/last-applied"
+	// AnnotationApplied is set on owners, listing the children applied the last time
+	AnnotationApplied = "apply.lasso.cattle.io/applied"
+)
+
+// ObjectRef identifies an applied child
+type ObjectRef struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+func (o ObjectRef) String() string {
+	if o.Namespace == "" {
+		return fmt.Sprintf("%s %s %s", o.APIVersion, o.Kind, o.Name)
+	}
+	return fmt.Sprintf("%s %s %s/%s", o.APIVersion, o.Kind, o.Namespace, o.Name)
+}
+
+func (o ObjectRef) groupVersionKind() schema.GroupVersionKind {
+	return schema.FromAPIVersionAndKind(o.APIVersion, o.Kind)
+}
+
+// sameObject returns whether both refs identify the same object, possibly through different versions of its kind
+func (o ObjectRef) sameObject(other ObjectRef) bool {
+	return o.groupVersionKind().GroupKind() == other.groupVersionKind().GroupKind() &&
+		o.Namespace == other.Namespace && o.Name == other.Name
+}
+
+// Patch is a change to an existing child
+type Patch struct {
+	Ref  ObjectRef
+	Type types.PatchType
+	Data []byte
+}
+
+// Plan lists the changes needed to reach the desired children
+type Plan struct {
+	Create []runtime.Object
+	Update []Patch
+	Delete []ObjectRef
+}
+
+// Empty returns whether the children are already in the desired state
+func (p *Plan) Empty() bool {
+	return len(p.Create) == 0 && len(p.Update) == 0 && len(p.Delete) == 0
+}
+
+// Applier applies sets of children. Existing children are read from the caches of the factory once they synced, and
+// from the API server otherwise. Note that the caches of the applied kinds are added to the factory, to be started with
+// it.
+type Applier struct {
+	caches  cache.SharedCacheFactory
+	clients client.SharedClientFactory
+}
+
+func NewApplier(caches cache.SharedCacheFactory) *Applier {
+	return &Applier{
+		caches:  caches,
+		clients: caches.SharedClientFactory(),
+	}
+}
+
+// Apply makes desired the children of owner, deleting the children that were applied previously but are no longer
+// desired. It returns the changes that were made.
+func (a *Applier) Apply(ctx context.Context, owner runtime.Object, desired ...runtime.Object) (*Plan, error) {
+	return a.apply(ctx, owner, desired, false)
+}
+
+// DryRun returns the changes Apply would make, without making them
+func (a *Applier) DryRun(ctx context.Context, owner runtime.Object, desired ...runtime.Object) (*Plan, error) {
+	return a.apply(ctx, owner, desired, true)
+}
+
+func (a *Applier) apply(ctx context.Context, owner runtime.Object, desired []runtime.Object, dryRun bool) (*Plan, error) {
+	o, err := a.newOwner(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+	var applied []ObjectRef
+	for _, obj := range desired {
+		child, ref, err := a.prepare(o, obj)
+		if err != nil {
+			return nil, err
+		}
+		if slices.ContainsFunc(applied, ref.sameObject) {
+			return nil, fmt.Errorf("%s is desired more than once", ref)
+		}
+		applied = append(applied, ref)
+
+		if err := a.applyChild(ctx, plan, child, ref, dryRun); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, ref := range a.prunable(o, applied) {
+		c, err := a.clients.ForKind(ref.groupVersionKind())
+		if err != nil {
+			return nil, err
+		}
+		// the annotation of the owner may list objects that were since replaced or taken over by someone else
+		current, err := a.get(ctx, c, ref.groupVersionKind(), ref)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil || !o.owns(current) {
+			continue
+		}
+		plan.Delete = append(plan.Delete, ref)
+		if dryRun {
+			continue
+		}
+		propagation := metav1.DeletePropagationBackground
+		err = c.Delete(ctx, ref.Namespace, ref.Name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("pruning %s: %w", ref, err)
+		}
+	}
+
+	if dryRun {
+		return plan, nil
+	}
+	return plan, a.setApplied(ctx, o, applied)
+}
+
+type ownerInfo struct {
+	gvk        schema.GroupVersionKind
+	meta       metav1.Object
+	namespaced bool
+	id         string
+	hash       string
+	applied    []ObjectRef
+}
+
+// owns returns whether obj is labelled and annotated as a child of the owner
+func (o *ownerInfo) owns(obj runtime.Object) bool {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return false
+	}
+	return m.GetLabels()[LabelOwnerHash] == o.hash && m.GetAnnotations()[AnnotationOwner] == o.id
+}
+
+func (a *Applier) newOwner(owner runtime.Object) (*ownerInfo, error) {
+	gvk, err := a.clients.GVKForObject(owner)
+	if err != nil {
+		return nil, err
+	}
+	m, err := meta.Accessor(owner)
+	if err != nil {
+		return nil, err
+	}
+	namespaced, err := a.clients.IsNamespaced(gvk)
+	if err != nil {
+		return nil, err
+	}
+
+	id := fmt.Sprintf("%s %s/%s", gvk.GroupKind(), m.GetNamespace(), m.GetName())
+	sum := sha256.Sum256([]byte(id))
+	o := &ownerInfo{
+		gvk:        gvk,
+		meta:       m,
+		namespaced: namespaced,
+		id:         id,
+		// label values are limited to 63 characters
+		hash: hex.EncodeToString(sum[:])[:32],
+	}
+	if value := m.GetAnnotations()[AnnotationApplied]; value != "" {
+		if err := json.Unmarshal([]byte(value), &o.applied); err != nil {
+			return nil, fmt.Errorf("parsing %s annotation of %s: %w", AnnotationApplied, id, err)
+		}
+	}
+	return o, nil
+}
+
+// prepare returns a copy of obj with the namespace, labels, annotations and owner reference of an applied child
+func (a *Applier) prepare(o *ownerInfo, obj runtime.Object) (runtime.Object, ObjectRef, error) {
+	child := obj.DeepCopyObject()
+	gvk, err := a.clients.GVKForObject(child)
+	if err != nil {
+		return nil, ObjectRef{}, err
+	}
+	m, err := meta.Accessor(child)
+	if err != nil {
+		return nil, ObjectRef{}, err
+	}
+	if m.GetName() == "" {
+		return nil, ObjectRef{}, fmt.Errorf("desired %s has no name", gvk.Kind)
+	}
+	namespaced, err := a.clients.IsNamespaced(gvk)
+	if err != nil {
+		return nil, ObjectRef{}, err
+	}
+	if !namespaced {
+		m.SetNamespace("")
+	} else if m.GetNamespace() == "" {
+		m.SetNamespace(o.meta.GetNamespace())
+	}
+
+	// setting the kind allows reading it from the last applied configuration
+	apiVersion, kind := gvk.ToAPIVersionAndKind()
+	if typeMeta, err := meta.TypeAccessor(child); err == nil {
+		typeMeta.SetAPIVersion(apiVersion)
+		typeMeta.SetKind(kind)
+	}
+
+	childLabels := m.GetLabels()
+	if childLabels == nil {
+		childLabels = map[string]string{}
+	}
+	childLabels[LabelOwnerHash] = o.hash
+	m.SetLabels(childLabels)
+
+	annotations := m.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[AnnotationOwner] = o.id
+	delete(annotations, AnnotationLastApplied)
+	m.SetAnnotations(annotations)
+
+	// owner references can only point to cluster-scoped owners or owners of the same namespace
+	if !o.namespaced || o.meta.GetNamespace() == m.GetNamespace() {
+		ownerAPIVersion, ownerKind := o.gvk.ToAPIVersionAndKind()
+		m.SetOwnerReferences(append(m.GetOwnerReferences(), metav1.OwnerReference{
+			APIVersion: ownerAPIVersion,
+			Kind:       ownerKind,
+			Name:       o.meta.GetName(),
+			UID:        o.meta.GetUID(),
+		}))
+	}
+
+	lastApplied, err := marshalPruned(child)
+	if err != nil {
+		return nil, ObjectRef{}, err
+	}
+	annotations[AnnotationLastApplied] = string(lastApplied)
+	m.SetAnnotations(annotations)
+
+	return child, ObjectRef{
+		APIVersion: apiVersion,
+		Kind:       kind,
+		Namespace:  m.GetNamespace(),
+		Name:       m.GetName(),
+	}, nil
+}
+
+func (a *Applier) applyChild(ctx context.Context, plan *Plan, child runtime.Object, ref ObjectRef, dryRun bool) error {
+	gvk := ref.groupVersionKind()
+	c, err := a.clients.ForKind(gvk)
+	if err != nil {
+		return err
+	}
+
+	current, err := a.get(ctx, c, gvk, ref)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		plan.Create = append(plan.Create, child)
+		if dryRun {
+			return nil
+		}
+		result, _, err := a.clients.NewObjects(gvk)
+		if err != nil {
+			return err
+		}
+		if err := c.Create(ctx, ref.Namespace, child, result, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("creating %s: %w", ref, err)
+		}
+		return nil
+	}
+
+	data, patchType, err := threeWayPatch(gvk, current, child)
+	if err != nil {
+		return fmt.Errorf("computing patch of %s: %w", ref, err)
+	}
+	if data == nil {
+		return nil
+	}
+	plan.Update = append(plan.Update, Patch{
+		Ref:  ref,
+		Type: patchType,
+		Data: data,
+	})
+	if dryRun {
+		return nil
+	}
+	result, _, err := a.clients.NewObjects(gvk)
+	if err != nil {
+		return err
+	}
+	if err := c.Patch(ctx, ref.Namespace, ref.Name, patchType, data, result, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("patching %s: %w", ref, err)
+	}
+	return nil
+}
+
+// get returns the existing child, or nil if it does not exist
+func (a *Applier) get(ctx context.Context, c *client.Client, gvk schema.GroupVersionKind, ref ObjectRef) (runtime.Object, error) {
+	if informer := a.syncedCache(gvk); informer != nil {
+		key := ref.Name
+		if ref.Namespace != "" {
+			key = ref.Namespace + "/" + ref.Name
+		}
+		obj, exists, err := informer.GetStore().GetByKey(key)
+		if err != nil || !exists {
+			return nil, err
+		}
+		return obj.(runtime.Object), nil
+	}
+
+	result, _, err := a.clients.NewObjects(gvk)
+	if err != nil {
+		return nil, err
+	}
+	err = c.Get(ctx, ref.Namespace, ref.Name, result, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	return result, err
+}
+
+// syncedCache returns the cache of the given kind, unless it has not synced yet
+func (a *Applier) syncedCache(gvk schema.GroupVersionKind) toolscache.SharedIndexInformer {
+	informer, err := a.caches.ForKind(gvk)
+	if err != nil || !informer.HasSynced() {
+		return nil
+	}
+	return informer
+}
+
+// prunable returns the children applied previously, or labelled as such in the caches, that are no longer desired
+func (a *Applier) prunable(o *ownerInfo, applied []ObjectRef) []ObjectRef {
+	var refs []ObjectRef
+	add := func(ref ObjectRef) {
+		if !slices.ContainsFunc(applied, ref.sameObject) && !slices.ContainsFunc(refs, ref.sameObject) {
+			refs = append(refs, ref)
+		}
+	}
+
+	kinds := map[schema.GroupVersionKind]bool{}
+	for _, ref := range o.applied {
+		add(ref)
+		kinds[ref.groupVersionKind()] = true
+	}
+	for _, ref := range applied {
+		kinds[ref.groupVersionKind()] = true
+	}
+
+	// children whose owner lost its annotation, or that were applied before a failure, are found through their label
+	for gvk := range kinds {
+		informer := a.syncedCache(gvk)
+		if informer == nil {
+			continue
+		}
+		for _, obj := range informer.GetStore().List() {
+			m, err := meta.Accessor(obj)
+			if err != nil || !o.owns(obj.(runtime.Object)) {
+				continue
+			}
+			apiVersion, kind := gvk.ToAPIVersionAndKind()
+			add(ObjectRef{
+				APIVersion: apiVersion,
+				Kind:       kind,
+				Namespace:  m.GetNamespace(),
+				Name:       m.GetName(),
+			})
+		}
+	}
+
+	slices.SortFunc(refs, func(a, b ObjectRef) int {
+		return strings.Compare(a.String(), b.String())
+	})
+	return refs
+}
+
+// setApplied records the applied children on the owner, so they are pruned once no longer desired
+func (a *Applier) setApplied(ctx context.Context, o *ownerInfo, applied []ObjectRef) error {
+	slices.SortFunc(applied, func(a, b ObjectRef) int {
+		return strings.Compare(a.String(), b.String())
+	})
+	if slices.Equal(applied, o.applied) {
+		return nil
+	}
+
+	value, err := json.Marshal(applied)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]string{
+				AnnotationApplied: string(value),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	c, err := a.clients.ForKind(o.gvk)
+	if err != nil {
+		return err
+	}
+	result, _, err := a.clients.NewObjects(o.gvk)
+	if err != nil {
+		return err
+	}
+	if err := c.Patch(ctx, o.meta.GetNamespace(), o.meta.GetName(), types.MergePatchType, patch, result, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("recording applied children on %s: %w", o.id, err)
+	}
+	return nil
+}
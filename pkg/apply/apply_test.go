@@ -0,0 +1,397 @@
+package apply
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rancher/lasso/pkg/cache"
+	"github.com/rancher/lasso/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	widgetV1 = schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	widgetV2 = schema.GroupVersionKind{Group: "example.com", Version: "v2", Kind: "Widget"}
+)
+
+// fakeServer is an in-memory API server of config maps and widgets, storing objects independently of their version
+type fakeServer struct {
+	lock     sync.Mutex
+	objects  map[string]map[string]any
+	requests []string
+	rv       int
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.lock.Lock()
+	s.requests = append(s.requests, req.Method+" "+req.URL.Path)
+	s.lock.Unlock()
+
+	if req.URL.Path == "/version" {
+		writeJSON(w, http.StatusOK, map[string]string{"major": "1"})
+		return
+	}
+	apiVersion, resource, namespace, name := parsePath(req.URL.Path)
+	if req.URL.Query().Get("watch") == "true" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if req.URL.Query().Get("sendInitialEvents") == "true" {
+			s.writeInitialEvents(w, apiVersion, resource, namespace)
+		}
+		w.(http.Flusher).Flush()
+		<-req.Context().Done()
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	key := strings.Join([]string{resource, namespace, name}, "/")
+	switch {
+	case req.Method == http.MethodGet && name == "":
+		list := map[string]any{
+			"apiVersion": apiVersion,
+			"kind":       kindFor(resource) + "List",
+			"metadata":   map[string]any{"resourceVersion": strconv.Itoa(s.rv)},
+		}
+		list["items"] = s.list(apiVersion, resource, namespace)
+		writeJSON(w, http.StatusOK, list)
+	case req.Method == http.MethodGet:
+		if obj, ok := s.objects[key]; ok {
+			writeJSON(w, http.StatusOK, withAPIVersion(obj, apiVersion))
+			return
+		}
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+	case req.Method == http.MethodPost:
+		var obj map[string]any
+		readJSON(req, &obj)
+		m := obj["metadata"].(map[string]any)
+		key = strings.Join([]string{resource, namespace, m["name"].(string)}, "/")
+		if _, ok := s.objects[key]; ok {
+			writeStatus(w, http.StatusConflict, metav1.StatusReasonAlreadyExists)
+			return
+		}
+		s.store(key, obj)
+		writeJSON(w, http.StatusCreated, obj)
+	case req.Method == http.MethodPatch:
+		obj, ok := s.objects[key]
+		if !ok {
+			writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+			return
+		}
+		var patch map[string]any
+		readJSON(req, &patch)
+		mergePatch(obj, patch)
+		s.store(key, obj)
+		writeJSON(w, http.StatusOK, withAPIVersion(obj, apiVersion))
+	case req.Method == http.MethodDelete:
+		if _, ok := s.objects[key]; !ok {
+			writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+			return
+		}
+		delete(s.objects, key)
+		writeJSON(w, http.StatusOK, metav1.Status{Status: metav1.StatusSuccess})
+	}
+}
+
+func (s *fakeServer) list(apiVersion, resource, namespace string) []any {
+	items := []any{}
+	for k, obj := range s.objects {
+		if strings.HasPrefix(k, resource+"/"+namespace) {
+			items = append(items, withAPIVersion(obj, apiVersion))
+		}
+	}
+	return items
+}
+
+// writeInitialEvents sends the events of a watch list: the existing objects, then a bookmark ending them
+func (s *fakeServer) writeInitialEvents(w http.ResponseWriter, apiVersion, resource, namespace string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	encoder := json.NewEncoder(w)
+	for _, obj := range s.list(apiVersion, resource, namespace) {
+		_ = encoder.Encode(map[string]any{"type": "ADDED", "object": obj})
+	}
+	_ = encoder.Encode(map[string]any{"type": "BOOKMARK", "object": map[string]any{
+		"apiVersion": apiVersion,
+		"kind":       kindFor(resource),
+		"metadata": map[string]any{
+			"resourceVersion": strconv.Itoa(s.rv),
+			"annotations":     map[string]any{metav1.InitialEventsAnnotationKey: "true"},
+		},
+	}})
+}
+
+func (s *fakeServer) store(key string, obj map[string]any) {
+	s.rv++
+	obj["metadata"].(map[string]any)["resourceVersion"] = strconv.Itoa(s.rv)
+	s.objects[key] = obj
+}
+
+func (s *fakeServer) add(t *testing.T, resource string, obj runtime.Object) {
+	data, err := json.Marshal(obj)
+	require.NoError(t, err)
+	var m map[string]any
+	require.NoError(t, json.Unmarshal(data, &m))
+	meta := m["metadata"].(map[string]any)
+	namespace, _ := meta["namespace"].(string)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.store(strings.Join([]string{resource, namespace, meta["name"].(string)}, "/"), m)
+}
+
+func (s *fakeServer) get(resource, namespace, name string) map[string]any {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.objects[strings.Join([]string{resource, namespace, name}, "/")]
+}
+
+func (s *fakeServer) owner(t *testing.T) *corev1.ConfigMap {
+	data, err := json.Marshal(s.get("configmaps", "ns", "owner"))
+	require.NoError(t, err)
+	owner := &corev1.ConfigMap{}
+	require.NoError(t, json.Unmarshal(data, owner))
+	return owner
+}
+
+func (s *fakeServer) sent(method string) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var result []string
+	for _, req := range s.requests {
+		if strings.HasPrefix(req, method+" ") {
+			result = append(result, req)
+		}
+	}
+	return result
+}
+
+// parsePath parses the paths of the form /api/v1/namespaces/ns/configmaps/name and
+// /apis/example.com/v1/namespaces/ns/widgets/name
+func parsePath(path string) (apiVersion, resource, namespace, name string) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if parts[0] == "api" {
+		apiVersion, parts = parts[1], parts[2:]
+	} else {
+		apiVersion, parts = parts[1]+"/"+parts[2], parts[3:]
+	}
+	if parts[0] == "namespaces" && len(parts) > 2 {
+		namespace, parts = parts[1], parts[2:]
+	}
+	resource = parts[0]
+	if len(parts) > 1 {
+		name = parts[1]
+	}
+	return
+}
+
+func kindFor(resource string) string {
+	if resource == "configmaps" {
+		return "ConfigMap"
+	}
+	return "Widget"
+}
+
+func withAPIVersion(obj map[string]any, apiVersion string) map[string]any {
+	result := map[string]any{}
+	for k, v := range obj {
+		result[k] = v
+	}
+	result["apiVersion"] = apiVersion
+	return result
+}
+
+func mergePatch(obj, patch map[string]any) {
+	for k, v := range patch {
+		switch v := v.(type) {
+		case nil:
+			delete(obj, k)
+		case map[string]any:
+			current, ok := obj[k].(map[string]any)
+			if !ok {
+				current = map[string]any{}
+				obj[k] = current
+			}
+			mergePatch(current, v)
+		default:
+			obj[k] = v
+		}
+	}
+}
+
+func readJSON(req *http.Request, into any) {
+	data, _ := io.ReadAll(req.Body)
+	_ = json.Unmarshal(data, into)
+}
+
+func writeJSON(w http.ResponseWriter, code int, obj any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(obj)
+}
+
+func writeStatus(w http.ResponseWriter, code int, reason metav1.StatusReason) {
+	writeJSON(w, code, metav1.Status{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Status"},
+		Status:   metav1.StatusFailure,
+		Reason:   reason,
+		Code:     int32(code),
+	})
+}
+
+func newTestApplier(t *testing.T) (*Applier, *fakeServer) {
+	server := &fakeServer{objects: map[string]map[string]any{}}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+	mapper.Add(widgetV1, meta.RESTScopeNamespace)
+	mapper.Add(widgetV2, meta.RESTScopeNamespace)
+
+	clients, err := client.NewSharedClientFactory(&rest.Config{Host: httpServer.URL}, &client.SharedClientFactoryOptions{
+		Mapper: mapper,
+		Scheme: scheme,
+	})
+	require.NoError(t, err)
+
+	server.add(t, "configmaps", &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns", UID: "uid"},
+	})
+	return NewApplier(cache.NewSharedCachedFactory(clients, nil)), server
+}
+
+func widget(gvk schema.GroupVersionKind, name, color string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{
+		"metadata": map[string]any{"name": name},
+		"spec":     map[string]any{"color": color},
+	}}
+	obj.SetGroupVersionKind(gvk)
+	return obj
+}
+
+func TestApplier_Apply(t *testing.T) {
+	t.Parallel()
+	a, server := newTestApplier(t)
+	ctx := context.Background()
+
+	plan, err := a.Apply(ctx, server.owner(t), widget(widgetV1, "a", "red"), widget(widgetV1, "b", "red"))
+	require.NoError(t, err)
+	assert.Len(t, plan.Create, 2)
+	b := server.get("widgets", "ns", "b")
+	require.NotNil(t, b, "created in the namespace of the owner")
+	assert.Equal(t, "ConfigMap ns/owner", b["metadata"].(map[string]any)["annotations"].(map[string]any)[AnnotationOwner])
+
+	plan, err = a.Apply(ctx, server.owner(t), widget(widgetV1, "a", "blue"))
+	require.NoError(t, err)
+	assert.Empty(t, plan.Create)
+	require.Len(t, plan.Update, 1)
+	assert.Equal(t, "a", plan.Update[0].Ref.Name)
+	assert.Equal(t, []ObjectRef{{APIVersion: "example.com/v1", Kind: "Widget", Namespace: "ns", Name: "b"}}, plan.Delete)
+	assert.Equal(t, "blue", server.get("widgets", "ns", "a")["spec"].(map[string]any)["color"])
+	assert.Nil(t, server.get("widgets", "ns", "b"), "pruned")
+
+	plan, err = a.Apply(ctx, server.owner(t), widget(widgetV1, "a", "blue"))
+	require.NoError(t, err)
+	assert.True(t, plan.Empty())
+}
+
+func TestApplier_Apply_versionChange(t *testing.T) {
+	t.Parallel()
+	a, server := newTestApplier(t)
+	ctx := context.Background()
+
+	_, err := a.Apply(ctx, server.owner(t), widget(widgetV1, "a", "red"))
+	require.NoError(t, err)
+
+	plan, err := a.Apply(ctx, server.owner(t), widget(widgetV2, "a", "blue"))
+	require.NoError(t, err)
+	assert.Len(t, plan.Update, 1)
+	assert.Empty(t, plan.Delete, "the child applied through another version is the same object")
+	assert.NotNil(t, server.get("widgets", "ns", "a"))
+	assert.Empty(t, server.sent(http.MethodDelete))
+}
+
+func TestApplier_Apply_pruneOwnedOnly(t *testing.T) {
+	t.Parallel()
+	a, server := newTestApplier(t)
+	ctx := context.Background()
+
+	_, err := a.Apply(ctx, server.owner(t), widget(widgetV1, "a", "red"), widget(widgetV1, "b", "red"))
+	require.NoError(t, err)
+	// b was taken over by someone else since
+	b := widget(widgetV1, "b", "green")
+	b.SetNamespace("ns")
+	server.add(t, "widgets", b)
+
+	plan, err := a.Apply(ctx, server.owner(t), widget(widgetV1, "a", "red"))
+	require.NoError(t, err)
+	assert.Empty(t, plan.Delete)
+	assert.NotNil(t, server.get("widgets", "ns", "b"), "not owned anymore")
+}
+
+func TestApplier_Apply_pruneLabelled(t *testing.T) {
+	t.Parallel()
+	a, server := newTestApplier(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	o, err := a.newOwner(server.owner(t))
+	require.NoError(t, err)
+	// an orphan applied before a failure, not listed on the owner
+	orphan := widget(widgetV1, "orphan", "red")
+	orphan.SetNamespace("ns")
+	orphan.SetLabels(map[string]string{LabelOwnerHash: o.hash})
+	orphan.SetAnnotations(map[string]string{AnnotationOwner: o.id})
+	server.add(t, "widgets", orphan)
+
+	_, err = a.caches.ForKind(widgetV1)
+	require.NoError(t, err)
+	require.NoError(t, a.caches.Start(ctx))
+	for gvk, synced := range a.caches.WaitForCacheSync(ctx) {
+		require.True(t, synced, gvk)
+	}
+
+	plan, err := a.Apply(ctx, server.owner(t), widget(widgetV1, "a", "red"))
+	require.NoError(t, err)
+	assert.Len(t, plan.Create, 1)
+	assert.Equal(t, []ObjectRef{{APIVersion: "example.com/v1", Kind: "Widget", Namespace: "ns", Name: "orphan"}}, plan.Delete)
+	assert.Nil(t, server.get("widgets", "ns", "orphan"))
+}
+
+func TestApplier_DryRun(t *testing.T) {
+	t.Parallel()
+	a, server := newTestApplier(t)
+	ctx := context.Background()
+
+	_, err := a.Apply(ctx, server.owner(t), widget(widgetV1, "a", "red"), widget(widgetV1, "b", "red"))
+	require.NoError(t, err)
+	writes := len(server.sent(http.MethodPost)) + len(server.sent(http.MethodPatch))
+
+	plan, err := a.DryRun(ctx, server.owner(t), widget(widgetV1, "a", "blue"), widget(widgetV1, "c", "red"))
+	require.NoError(t, err)
+	assert.Len(t, plan.Create, 1)
+	assert.Len(t, plan.Update, 1)
+	assert.Len(t, plan.Delete, 1)
+	assert.Equal(t, writes, len(server.sent(http.MethodPost))+len(server.sent(http.MethodPatch)), "nothing written")
+	assert.Empty(t, server.sent(http.MethodDelete))
+	assert.NotNil(t, server.get("widgets", "ns", "b"))
+}
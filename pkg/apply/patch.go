@@ -0,0 +1,145 @@
+package apply
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// threeWayPatch returns the patch turning current into desired, deleting the fields of the last applied configuration
+// of current that are no longer desired. A nil patch is returned when nothing changes.
+func threeWayPatch(gvk schema.GroupVersionKind, current, desired runtime.Object) ([]byte, types.PatchType, error) {
+	currentMeta, err := meta.Accessor(current)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var original []byte
+	if lastApplied := currentMeta.GetAnnotations()[AnnotationLastApplied]; lastApplied != "" {
+		original, err = prunedJSON([]byte(lastApplied))
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	modified, err := marshalPruned(desired)
+	if err != nil {
+		return nil, "", err
+	}
+	currentJSON, err := json.Marshal(current)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// strategic merge patches need the patch strategies of the Go struct, only known for the built-in types
+	if _, ok := desired.(*unstructured.Unstructured); !ok && scheme.Scheme.Recognizes(gvk) {
+		patchMeta, err := strategicpatch.NewPatchMetaFromStruct(desired)
+		if err != nil {
+			return nil, "", err
+		}
+		patch, err := strategicpatch.CreateThreeWayMergePatch(original, modified, currentJSON, patchMeta, true)
+		if err != nil || string(patch) == "{}" {
+			return nil, "", err
+		}
+		return patch, types.StrategicMergePatchType, nil
+	}
+
+	patch, err := threeWayMergePatch(original, modified, currentJSON)
+	if err != nil || patch == nil {
+		return nil, "", err
+	}
+	return patch, types.MergePatchType, nil
+}
+
+// threeWayMergePatch returns a JSON merge patch setting the fields of modified that differ in current, and deleting
+// the fields of original that are not in modified
+func threeWayMergePatch(original, modified, current []byte) ([]byte, error) {
+	var originalMap, modifiedMap, currentMap map[string]any
+	if len(original) > 0 {
+		if err := json.Unmarshal(original, &originalMap); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(modified, &modifiedMap); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(current, &currentMap); err != nil {
+		return nil, err
+	}
+
+	patch := diffMaps(originalMap, modifiedMap, currentMap)
+	if len(patch) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(patch)
+}
+
+func diffMaps(original, modified, current map[string]any) map[string]any {
+	patch := map[string]any{}
+	for key := range original {
+		if _, ok := modified[key]; !ok {
+			if _, exists := current[key]; exists {
+				patch[key] = nil
+			}
+		}
+	}
+	for key, value := range modified {
+		currentValue, exists := current[key]
+		if !exists {
+			patch[key] = value
+			continue
+		}
+		valueMap, isMap := value.(map[string]any)
+		currentValueMap, currentIsMap := currentValue.(map[string]any)
+		if isMap && currentIsMap {
+			originalValueMap, _ := original[key].(map[string]any)
+			if nested := diffMaps(originalValueMap, valueMap, currentValueMap); len(nested) > 0 {
+				patch[key] = nested
+			}
+			continue
+		}
+		if !reflect.DeepEqual(value, currentValue) {
+			patch[key] = value
+		}
+	}
+	return patch
+}
+
+func marshalPruned(obj runtime.Object) ([]byte, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	return prunedJSON(data)
+}
+
+// prunedJSON removes the null values and empty objects, such as the creationTimestamp and status serialized for
+// typed objects, which would otherwise be patched over the values set by the API server
+func prunedJSON(data []byte) ([]byte, error) {
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	prune(m)
+	return json.Marshal(m)
+}
+
+func prune(m map[string]any) {
+	for key, value := range m {
+		switch v := value.(type) {
+		case nil:
+			delete(m, key)
+		case map[string]any:
+			prune(v)
+			if len(v) == 0 {
+				delete(m, key)
+			}
+		}
+	}
+}
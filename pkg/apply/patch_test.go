@@ -0,0 +1,107 @@
+package apply
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestThreeWayMergePatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		original string
+		modified string
+		current  string
+		want     string
+	}{
+		{
+			name:     "unchanged",
+			original: `{"spec":{"a":"1"}}`,
+			modified: `{"spec":{"a":"1"}}`,
+			current:  `{"spec":{"a":"1","b":"server"}}`,
+		},
+		{
+			name:     "changed field",
+			original: `{"spec":{"a":"1"}}`,
+			modified: `{"spec":{"a":"2"}}`,
+			current:  `{"spec":{"a":"1","b":"server"}}`,
+			want:     `{"spec":{"a":"2"}}`,
+		},
+		{
+			name:     "field no longer desired",
+			original: `{"spec":{"a":"1","c":"3"}}`,
+			modified: `{"spec":{"a":"1"}}`,
+			current:  `{"spec":{"a":"1","b":"server","c":"3"}}`,
+			want:     `{"spec":{"c":null}}`,
+		},
+		{
+			name:     "no last applied configuration",
+			modified: `{"spec":{"a":"1"}}`,
+			current:  `{"spec":{"b":"server"}}`,
+			want:     `{"spec":{"a":"1"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := threeWayMergePatch([]byte(tt.original), []byte(tt.modified), []byte(tt.current))
+			require.NoError(t, err)
+			if tt.want == "" {
+				assert.Nil(t, patch)
+				return
+			}
+			assert.JSONEq(t, tt.want, string(patch))
+		})
+	}
+}
+
+func TestThreeWayPatch_Typed(t *testing.T) {
+	desired := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+		Data:       map[string]string{"a": "1"},
+	}
+	lastApplied, err := marshalPruned(desired)
+	require.NoError(t, err)
+	desired.Annotations = map[string]string{AnnotationLastApplied: string(lastApplied)}
+
+	current := desired.DeepCopy()
+	current.ResourceVersion = "5"
+	current.CreationTimestamp = metav1.Now()
+	gvk := corev1.SchemeGroupVersion.WithKind("ConfigMap")
+
+	patch, patchType, err := threeWayPatch(gvk, current, desired)
+	require.NoError(t, err)
+	assert.Nil(t, patch, "fields set by the server must not be patched")
+
+	current.Data["a"] = "changed"
+	patch, patchType, err = threeWayPatch(gvk, current, desired)
+	require.NoError(t, err)
+	assert.Equal(t, types.StrategicMergePatchType, patchType)
+	assert.JSONEq(t, `{"data":{"a":"1"}}`, string(patch))
+}
+
+func TestThreeWayPatch_Unstructured(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	desired := &unstructured.Unstructured{}
+	desired.SetGroupVersionKind(gvk)
+	desired.SetName("widget")
+	require.NoError(t, unstructured.SetNestedField(desired.Object, "1", "spec", "a"))
+
+	current := desired.DeepCopy()
+	require.NoError(t, unstructured.SetNestedField(current.Object, "3", "spec", "c"))
+	lastApplied, err := json.Marshal(current.Object)
+	require.NoError(t, err)
+	current.SetAnnotations(map[string]string{AnnotationLastApplied: string(lastApplied)})
+	desired.SetAnnotations(map[string]string{AnnotationLastApplied: `{}`})
+
+	patch, patchType, err := threeWayPatch(gvk, current, desired)
+	require.NoError(t, err)
+	assert.Equal(t, types.MergePatchType, patchType)
+	assert.JSONEq(t, `{"metadata":{"annotations":{"`+AnnotationLastApplied+`":"{}"}},"spec":{"c":null}}`, string(patch))
+}
@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/rancher/lasso/pkg/client"
 	"github.com/rancher/lasso/pkg/log"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
@@ -18,6 +20,9 @@ import (
 const (
 	// in minutes
 	resyncDefault = 600
+
+	// OwnerUIDIndex is the name of the index of cached objects by the UID of their owners, see Options.OwnerIndex
+	OwnerUIDIndex = "lasso.cattle.io/owner-uid"
 )
 
 type Options struct {
@@ -26,6 +31,8 @@ type Options struct {
 	TweakList        TweakListOptionsFunc
 	WaitHealthy      func(ctx context.Context)
 	DisableWatchList bool
+	// OwnerIndex adds OwnerUIDIndex to the cache
+	OwnerIndex bool
 }
 
 func NewCache(obj, listObj runtime.Object, client *client.Client, opts *Options) cache.SharedIndexInformer {
@@ -36,6 +43,9 @@ func NewCache(obj, listObj runtime.Object, client *client.Client, opts *Options)
 	}
 
 	opts = applyDefaultCacheOptions(opts)
+	if opts.OwnerIndex {
+		indexers[OwnerUIDIndex] = OwnerUIDIndexFunc
+	}
 
 	lw := &deferredListWatcher{
 		client:           client,
@@ -46,17 +56,36 @@ func NewCache(obj, listObj runtime.Object, client *client.Client, opts *Options)
 		disableWatchList: opts.DisableWatchList,
 	}
 
+	informer := cache.NewSharedIndexInformer(
+		lw,
+		obj,
+		opts.Resync,
+		indexers,
+	)
+
 	return &deferredCache{
-		SharedIndexInformer: cache.NewSharedIndexInformer(
-			lw,
-			obj,
-			opts.Resync,
-			indexers,
-		),
+		SharedIndexInformer: informer,
 		deferredListWatcher: lw,
 	}
 }
 
+// OwnerUIDIndexFunc indexes objects by the UIDs of their owner references
+func OwnerUIDIndexFunc(obj interface{}) ([]string, error) {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	refs := m.GetOwnerReferences()
+	if len(refs) == 0 {
+		return nil, nil
+	}
+	uids := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		uids = append(uids, string(ref.UID))
+	}
+	return uids, nil
+}
+
 func applyDefaultCacheOptions(opts *Options) *Options {
 	var newOpts Options
 	if opts != nil {
@@ -87,6 +116,10 @@ func getDefaultResyncInterval() time.Duration {
 type deferredCache struct {
 	cache.SharedIndexInformer
 	deferredListWatcher *deferredListWatcher
+
+	// waiters are added on the first WaitForResourceVersion, so caches never waited on have no extra event handler
+	waitersLock sync.Mutex
+	waiters     *resourceVersionWaiters
 }
 
 type deferredListWatcher struct {
@@ -151,6 +184,22 @@ func (d *deferredListWatcher) run(stopCh <-chan struct{}) {
 	}
 }
 
+func (d *deferredCache) WaitForResourceVersion(ctx context.Context, key, resourceVersion string) error {
+	d.waitersLock.Lock()
+	if d.waiters == nil {
+		waiters, err := addResourceVersionWaiters(d.SharedIndexInformer)
+		if err != nil {
+			d.waitersLock.Unlock()
+			return err
+		}
+		d.waiters = waiters
+	}
+	waiters := d.waiters
+	d.waitersLock.Unlock()
+
+	return waiters.wait(ctx, key, resourceVersion)
+}
+
 func (d *deferredCache) Run(stopCh <-chan struct{}) {
 	d.deferredListWatcher.run(stopCh)
 	d.SharedIndexInformer.Run(stopCh)
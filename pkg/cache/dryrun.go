@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/rancher/lasso/pkg/client"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// CachedObjectFunc returns a client.CurrentObjectFunc reading the objects from the synced caches of f, and from the API
+// server for the kinds f does not cache. As the option of the client factory f is built from, it is meant to be set
+// through a closure, for instance:
+//
+//	var caches cache.SharedCacheFactory
+//	clients, err := client.NewSharedClientFactory(config, &client.SharedClientFactoryOptions{
+//		DryRun: true,
+//		DryRunCurrentObject: func(ctx context.Context, gvr schema.GroupVersionResource, namespace, name string) (runtime.Object, error) {
+//			return cache.CachedObjectFunc(caches)(ctx, gvr, namespace, name)
+//		},
+//	})
+//	caches = cache.NewSharedCachedFactory(clients, nil)
+func CachedObjectFunc(f SharedCacheFactory) client.CurrentObjectFunc {
+	return func(ctx context.Context, gvr schema.GroupVersionResource, namespace, name string) (runtime.Object, error) {
+		gvk, err := f.SharedClientFactory().GVKForResource(gvr)
+		if err != nil {
+			return nil, err
+		}
+
+		if sf, ok := f.(*sharedCacheFactory); ok {
+			if informer := sf.syncedCache(gvk); informer != nil {
+				key := name
+				if namespace != "" {
+					key = namespace + "/" + name
+				}
+				obj, exists, err := informer.GetStore().GetByKey(key)
+				if err != nil || !exists {
+					return nil, err
+				}
+				return obj.(runtime.Object), nil
+			}
+		}
+
+		c, err := f.SharedClientFactory().ForKind(gvk)
+		if err != nil {
+			return nil, err
+		}
+		obj := &unstructured.Unstructured{}
+		err = c.Get(ctx, namespace, name, obj, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return obj, err
+	}
+}
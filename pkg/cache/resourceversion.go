@@ -0,0 +1,196 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ResourceVersionWaiter is implemented by the caches created with NewCache
+type ResourceVersionWaiter interface {
+	// WaitForResourceVersion blocks until the cached object of key has the given resourceVersion or a newer one, the
+	// object was deleted, or ctx is done.
+	WaitForResourceVersion(ctx context.Context, key, resourceVersion string) error
+}
+
+// InformerWaiters waits for informers to cache resourceVersions. The informers not created by NewCache get an event
+// handler on their first wait, added once per informer and kept for the lifetime of the informer.
+type InformerWaiters struct {
+	lock    sync.Mutex
+	waiters map[cache.SharedIndexInformer]*resourceVersionWaiters
+}
+
+func NewInformerWaiters() *InformerWaiters {
+	return &InformerWaiters{
+		waiters: map[cache.SharedIndexInformer]*resourceVersionWaiters{},
+	}
+}
+
+// WaitForResourceVersion blocks until the informer caches the given resourceVersion of the object of key, or a newer
+// one.
+func (i *InformerWaiters) WaitForResourceVersion(ctx context.Context, informer cache.SharedIndexInformer, key, resourceVersion string) error {
+	if waiter, ok := informer.(ResourceVersionWaiter); ok {
+		return waiter.WaitForResourceVersion(ctx, key, resourceVersion)
+	}
+
+	waiters, err := i.forInformer(informer)
+	if err != nil {
+		return err
+	}
+	return waiters.wait(ctx, key, resourceVersion)
+}
+
+func (i *InformerWaiters) forInformer(informer cache.SharedIndexInformer) (*resourceVersionWaiters, error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if waiters, ok := i.waiters[informer]; ok {
+		return waiters, nil
+	}
+	waiters, err := addResourceVersionWaiters(informer)
+	if err != nil {
+		return nil, err
+	}
+	i.waiters[informer] = waiters
+	return waiters, nil
+}
+
+// ResourceVersionReached returns whether current is the same or a newer resourceVersion than target. Resource versions
+// are compared as integers, which they are for etcd backed resources, and only compared for equality otherwise.
+func ResourceVersionReached(current, target string) bool {
+	currentInt, currentErr := strconv.ParseUint(current, 10, 64)
+	targetInt, targetErr := strconv.ParseUint(target, 10, 64)
+	if currentErr != nil || targetErr != nil {
+		return current == target
+	}
+	return currentInt >= targetInt
+}
+
+// resourceVersionWaiters notifies the callers waiting for a key when the informer delivers events for it
+type resourceVersionWaiters struct {
+	store cache.Store
+
+	lock    sync.Mutex
+	waiters map[string][]*resourceVersionWaiter
+}
+
+type resourceVersionWaiter struct {
+	resourceVersion string
+	done            chan struct{}
+}
+
+func newResourceVersionWaiters(store cache.Store) *resourceVersionWaiters {
+	return &resourceVersionWaiters{
+		store:   store,
+		waiters: map[string][]*resourceVersionWaiter{},
+	}
+}
+
+// addResourceVersionWaiters returns waiters notified by a new event handler of informer
+func addResourceVersionWaiters(informer cache.SharedIndexInformer) (*resourceVersionWaiters, error) {
+	waiters := newResourceVersionWaiters(informer.GetStore())
+	if _, err := informer.AddEventHandler(waiters.handler()); err != nil {
+		return nil, err
+	}
+	return waiters, nil
+}
+
+func (r *resourceVersionWaiters) handler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			r.notify(obj, false)
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			r.notify(obj, false)
+		},
+		DeleteFunc: func(obj interface{}) {
+			r.notify(obj, true)
+		},
+	}
+}
+
+func (r *resourceVersionWaiters) wait(ctx context.Context, key, resourceVersion string) error {
+	waiter := &resourceVersionWaiter{
+		resourceVersion: resourceVersion,
+		done:            make(chan struct{}),
+	}
+
+	r.lock.Lock()
+	// checking the store while holding the lock guarantees an event received afterward notifies the waiter
+	if r.reached(key, resourceVersion) {
+		r.lock.Unlock()
+		return nil
+	}
+	r.waiters[key] = append(r.waiters[key], waiter)
+	r.lock.Unlock()
+
+	select {
+	case <-waiter.done:
+		return nil
+	case <-ctx.Done():
+		r.remove(key, waiter)
+		return ctx.Err()
+	}
+}
+
+// reached must be called while holding the lock
+func (r *resourceVersionWaiters) reached(key, resourceVersion string) bool {
+	obj, exists, err := r.store.GetByKey(key)
+	if err != nil || !exists {
+		return false
+	}
+	m, err := meta.Accessor(obj)
+	return err == nil && ResourceVersionReached(m.GetResourceVersion(), resourceVersion)
+}
+
+func (r *resourceVersionWaiters) notify(obj interface{}, deleted bool) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	waiters := r.waiters[key]
+	pending := waiters[:0]
+	for _, waiter := range waiters {
+		// there is nothing more to wait for once the object is deleted
+		if deleted || ResourceVersionReached(m.GetResourceVersion(), waiter.resourceVersion) {
+			close(waiter.done)
+		} else {
+			pending = append(pending, waiter)
+		}
+	}
+	if len(pending) == 0 {
+		delete(r.waiters, key)
+	} else {
+		r.waiters[key] = pending
+	}
+}
+
+func (r *resourceVersionWaiters) remove(key string, waiter *resourceVersionWaiter) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	waiters := r.waiters[key]
+	for i := range waiters {
+		if waiters[i] == waiter {
+			r.waiters[key] = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(r.waiters[key]) == 0 {
+		delete(r.waiters, key)
+	}
+}
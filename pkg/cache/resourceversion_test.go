@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rancher/lasso/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestResourceVersionWaiters(t *testing.T) {
+	t.Parallel()
+
+	store := cache.NewStore(cache.DeletionHandlingMetaNamespaceKeyFunc)
+	waiters := newResourceVersionWaiters(store)
+	handler := waiters.handler()
+	newConfigMap := func(resourceVersion string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "cm", ResourceVersion: resourceVersion}}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	old := newConfigMap("9")
+	require.NoError(t, store.Add(old))
+
+	// the cache already holds a newer version
+	require.NoError(t, waiters.wait(ctx, "ns/cm", "8"))
+
+	done := make(chan error)
+	go func() {
+		done <- waiters.wait(ctx, "ns/cm", "10")
+	}()
+	// wait for the waiter to be registered
+	require.Eventually(t, func() bool {
+		waiters.lock.Lock()
+		defer waiters.lock.Unlock()
+		return len(waiters.waiters["ns/cm"]) == 1
+	}, time.Second, time.Millisecond)
+
+	// the waiter is notified by events, not by changes to the store
+	updated := newConfigMap("10")
+	require.NoError(t, store.Update(updated))
+	handler.OnUpdate(old, updated)
+	require.NoError(t, <-done)
+
+	// deleting the object releases waiters
+	go func() {
+		done <- waiters.wait(ctx, "ns/cm", "20")
+	}()
+	require.Eventually(t, func() bool {
+		waiters.lock.Lock()
+		defer waiters.lock.Unlock()
+		return len(waiters.waiters["ns/cm"]) == 1
+	}, time.Second, time.Millisecond)
+	handler.OnDelete(cache.DeletedFinalStateUnknown{Key: "ns/cm", Obj: updated})
+	require.NoError(t, <-done)
+
+	// waiting stops with the context
+	shortCtx, shortCancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer shortCancel()
+	assert.ErrorIs(t, waiters.wait(shortCtx, "ns/cm", "30"), context.DeadlineExceeded)
+	assert.Empty(t, waiters.waiters)
+}
+
+func TestResourceVersionReached(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, ResourceVersionReached("10", "9"))
+	assert.True(t, ResourceVersionReached("10", "10"))
+	assert.False(t, ResourceVersionReached("9", "10"))
+	assert.True(t, ResourceVersionReached("abc", "abc"))
+	assert.False(t, ResourceVersionReached("abd", "abc"))
+}
+
+func TestInformerWaiters(t *testing.T) {
+	t.Parallel()
+
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{}, &corev1.ConfigMap{}, 0, cache.Indexers{})
+	require.NoError(t, informer.GetStore().Add(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "cm", ResourceVersion: "10"}}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	informerWaiters := NewInformerWaiters()
+	require.NoError(t, informerWaiters.WaitForResourceVersion(ctx, informer, "ns/cm", "9"))
+	waiters, err := informerWaiters.forInformer(informer)
+	require.NoError(t, err)
+
+	require.NoError(t, informerWaiters.WaitForResourceVersion(ctx, informer, "ns/cm", "10"))
+	again, err := informerWaiters.forInformer(informer)
+	require.NoError(t, err)
+	assert.Same(t, waiters, again, "the event handler is only added once per informer")
+}
+
+func TestNewCache_waitersAddedOnFirstWait(t *testing.T) {
+	t.Parallel()
+
+	gvr := corev1.SchemeGroupVersion.WithResource("configmaps")
+	c := NewCache(&corev1.ConfigMap{}, &corev1.ConfigMapList{}, client.NewClient(gvr, "ConfigMap", true, nil, 0), nil).(*deferredCache)
+	assert.Nil(t, c.waiters, "no event handler until a write is waited on")
+	require.NoError(t, c.GetStore().Add(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "cm", ResourceVersion: "10"}}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, c.WaitForResourceVersion(ctx, "ns/cm", "10"))
+	waiters := c.waiters
+	require.NotNil(t, waiters)
+	require.NoError(t, c.WaitForResourceVersion(ctx, "ns/cm", "9"))
+	assert.Same(t, waiters, c.waiters)
+}
@@ -27,6 +27,10 @@ type SharedCacheFactoryOptions struct {
 	KindDisableWatchList map[schema.GroupVersionKind]bool
 	HealthCallback       func(healthy bool)
 
+	// OwnerIndex adds cache.OwnerUIDIndex to every cache, so the children of an object can be listed without
+	// scanning the whole cache.
+	OwnerIndex bool
+
 	// Determines how often metrics are gathered about how many resources are
 	// cached by gvk across all caches in the sharedCacheFactory
 	MetricsCollectionPeriod time.Duration
@@ -45,6 +49,7 @@ type sharedCacheFactory struct {
 	customDisableWatchList  map[schema.GroupVersionKind]bool
 	sharedClientFactory     client.SharedClientFactory
 	healthcheck             healthcheck
+	ownerIndex              bool
 
 	caches        map[schema.GroupVersionKind]cache.SharedIndexInformer
 	startedCaches map[schema.GroupVersionKind]bool
@@ -73,6 +78,7 @@ func NewSharedCachedFactory(sharedClientFactory client.SharedClientFactory, opts
 			callback: opts.HealthCallback,
 		},
 		metricsCollectionPeriod: opts.MetricsCollectionPeriod,
+		ownerIndex:              opts.OwnerIndex,
 	}
 
 	return factory
@@ -152,6 +158,18 @@ func (f *sharedCacheFactory) WaitForCacheSync(ctx context.Context) map[schema.Gr
 	return res
 }
 
+// syncedCache returns the cache of gvk if it was started and synced, without creating it
+func (f *sharedCacheFactory) syncedCache(gvk schema.GroupVersionKind) cache.SharedIndexInformer {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	informer, ok := f.caches[gvk]
+	if !ok || !f.startedCaches[gvk] || !informer.HasSynced() {
+		return nil
+	}
+	return informer
+}
+
 func (f *sharedCacheFactory) ForObject(obj runtime.Object) (cache.SharedIndexInformer, error) {
 	return f.ForKind(obj.GetObjectKind().GroupVersionKind())
 }
@@ -224,6 +242,7 @@ func (f *sharedCacheFactory) ForResourceKind(gvr schema.GroupVersionResource, ki
 		TweakList:        tweakList,
 		WaitHealthy:      f.healthcheck.ensureHealthy,
 		DisableWatchList: disableWatchList,
+		OwnerIndex:       f.ownerIndex,
 	})
 	f.caches[gvk] = cache
 
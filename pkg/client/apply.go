@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ApplyOptions configures a server-side apply request
+type ApplyOptions struct {
+	// FieldManager owns the applied fields, defaulting to the field manager of the Client. It is required.
+	FieldManager string
+	// Force takes the ownership of the fields that conflict with other field managers
+	Force bool
+	// DryRun is passed as the dryRun query parameter, for instance metav1.DryRunAll
+	DryRun []string
+}
+
+// WithFieldManager returns a copy of the Client using the given field manager when ApplyOptions do not set one
+func (c *Client) WithFieldManager(fieldManager string) *Client {
+	client := *c
+	client.fieldManager = fieldManager
+	return &client
+}
+
+// Apply sends obj as a server-side apply patch in the given namespace (if client.Namespaced is set to true), obj only
+// holding the fields owned by the field manager. Typed and unstructured objects are supported, the apiVersion and kind
+// of the client being set if obj does not have them. The null and empty fields of typed objects, such as an empty
+// status, are left out as they cannot be told apart from unset fields: use an unstructured object to apply them.
+// Apply will then attempt to unmarshal the resulting object from the response into the provide result object.
+func (c *Client) Apply(ctx context.Context, namespace string, obj, result runtime.Object, opts ApplyOptions) error {
+	return c.apply(ctx, namespace, obj, result, opts)
+}
+
+// ApplyStatus is like Apply, applying the status subresource
+func (c *Client) ApplyStatus(ctx context.Context, namespace string, obj, result runtime.Object, opts ApplyOptions) error {
+	return c.apply(ctx, namespace, obj, result, opts, "status")
+}
+
+func (c *Client) apply(ctx context.Context, namespace string, obj, result runtime.Object, opts ApplyOptions, subresources ...string) error {
+	fieldManager := opts.FieldManager
+	if fieldManager == "" {
+		fieldManager = c.fieldManager
+	}
+	if fieldManager == "" {
+		return fmt.Errorf("server-side apply of %s requires a field manager", c.GVR.Resource)
+	}
+
+	u, err := c.applyConfiguration(obj)
+	if err != nil {
+		return err
+	}
+	if u.GetName() == "" {
+		return fmt.Errorf("server-side apply of %s requires a name", c.GVR.Resource)
+	}
+	data, err := json.Marshal(u.Object)
+	if err != nil {
+		return err
+	}
+
+	patchOpts := metav1.PatchOptions{
+		FieldManager: fieldManager,
+		DryRun:       opts.DryRun,
+	}
+	if opts.Force {
+		patchOpts.Force = &opts.Force
+	}
+	return c.Patch(ctx, namespace, u.GetName(), types.ApplyPatchType, data, result, patchOpts, subresources...)
+}
+
+// applyConfiguration converts obj to the body of an apply patch
+func (c *Client) applyConfiguration(obj runtime.Object) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := obj.(runtime.Unstructured); !ok {
+		pruneZeroFields(content)
+	}
+	u := &unstructured.Unstructured{Object: content}
+	if u.GetAPIVersion() == "" {
+		u.SetAPIVersion(c.apiVersion)
+	}
+	if u.GetKind() == "" {
+		u.SetKind(c.kind)
+	}
+	if u.GetKind() == "" {
+		return nil, fmt.Errorf("server-side apply of %s requires the kind of the object", c.GVR.Resource)
+	}
+
+	// the API server rejects apply patches setting managed fields, and typed objects serialize a null creationTimestamp
+	unstructured.RemoveNestedField(u.Object, "metadata", "managedFields")
+	if metadata, ok := u.Object["metadata"].(map[string]any); ok && metadata["creationTimestamp"] == nil {
+		delete(metadata, "creationTimestamp")
+	}
+	return u, nil
+}
+
+// pruneZeroFields removes the null values and the objects left empty, which typed objects serialize for the fields
+// without omitempty and the struct fields
+func pruneZeroFields(m map[string]any) {
+	for key, value := range m {
+		switch v := value.(type) {
+		case nil:
+			delete(m, key)
+		case map[string]any:
+			pruneZeroFields(v)
+			if len(v) == 0 {
+				delete(m, key)
+			}
+		case []any:
+			for _, item := range v {
+				if itemMap, ok := item.(map[string]any); ok {
+					pruneZeroFields(itemMap)
+				}
+			}
+		}
+	}
+}
@@ -8,10 +8,13 @@ package client
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
@@ -23,15 +26,37 @@ import (
 type Client struct {
 	// Default RESTClient
 	RESTClient rest.Interface
+	// protobuf is the RESTClient used instead of RESTClient for typed objects, if the kind supports protobuf
+	protobuf rest.Interface
 	// Config that can be used to build a RESTClient with custom options
-	Config     rest.Config
-	timeout    time.Duration
-	Namespaced bool
-	GVR        schema.GroupVersionResource
-	resource   string
-	prefix     []string
-	apiVersion string
-	kind       string
+	Config       rest.Config
+	timeout      time.Duration
+	Namespaced   bool
+	GVR          schema.GroupVersionResource
+	resource     string
+	prefix       []string
+	apiVersion   string
+	kind         string
+	writeWaiter  WriteWaiter
+	fieldManager string
+	interceptors []Interceptor
+	// dryRun and rateLimit are set by the factory and always run innermost, after interceptors, so no interceptor can
+	// send a write without dry-run or a request without waiting for the rate limit
+	dryRun    Interceptor
+	rateLimit Interceptor
+	// unstructured makes the watches deliver Unstructured objects, and the requests never use protobuf
+	unstructured bool
+}
+
+// WriteWaiter blocks until a cache reflects the given resourceVersion of the object of key
+type WriteWaiter interface {
+	WaitForResourceVersion(ctx context.Context, key, resourceVersion string) error
+}
+
+type WriteWaiterFunc func(ctx context.Context, key, resourceVersion string) error
+
+func (w WriteWaiterFunc) WaitForResourceVersion(ctx context.Context, key, resourceVersion string) error {
+	return w(ctx, key, resourceVersion)
 }
 
 // IsNamespaced determines if the give GroupVersionResource is namespaced using the given RESTMapper.
@@ -61,6 +86,11 @@ func (c *Client) WithAgent(userAgent string) (*Client, error) {
 		return nil, fmt.Errorf("failed to created restClient with userAgent [%s]: %w", userAgent, err)
 	}
 	client.RESTClient = restClient
+	if c.protobuf != nil {
+		if client.protobuf, err = protobufRESTClientFor(config); err != nil {
+			return nil, err
+		}
+	}
 	client.Config = config
 	return &client, nil
 }
@@ -76,10 +106,32 @@ func (c *Client) WithImpersonation(impersonate rest.ImpersonationConfig) (*Clien
 		return nil, fmt.Errorf("failed to created restClient with impersonation [%v]: %w", impersonate, err)
 	}
 	client.RESTClient = restClient
+	if c.protobuf != nil {
+		if client.protobuf, err = protobufRESTClientFor(config); err != nil {
+			return nil, err
+		}
+	}
 	client.Config = config
 	return &client, nil
 }
 
+// WithWriteWaiter returns a copy of the Client whose Create, Update, UpdateStatus and Patch calls only return once the
+// given WriteWaiter reflects the written object, so it can be read back from a cache. An error while waiting is
+// returned although the write itself succeeded.
+func (c *Client) WithWriteWaiter(waiter WriteWaiter) *Client {
+	client := *c
+	client.writeWaiter = waiter
+	return &client
+}
+
+// WithUnstructured returns a copy of the Client whose watches deliver *unstructured.Unstructured objects rather than the
+// types registered in the scheme, and whose requests never use protobuf.
+func (c *Client) WithUnstructured() *Client {
+	client := *c
+	client.unstructured = true
+	return &client
+}
+
 // NewClient will create a client for the given GroupResourceVersion and Kind.
 // If namespaced is set to true all request will be sent with the scoped to a namespace.
 // The namespaced option can be changed after creation with the client.Namespace variable.
@@ -133,18 +185,26 @@ func (c *Client) setupCtx(ctx context.Context) (context.Context, func()) {
 // If the returned response object is of type Status and has .Status != StatusSuccess, the
 // additional information in Status will be used to enrich the error.
 func (c *Client) Get(ctx context.Context, namespace, name string, result runtime.Object, options metav1.GetOptions) (err error) {
-	defer c.setKind(result)
-	ctx, cancel := c.setupCtx(ctx)
-	defer cancel()
-	err = c.RESTClient.Get().
-		Prefix(c.prefix...).
-		NamespaceIfScoped(namespace, c.Namespaced).
-		Resource(c.resource).
-		Name(name).
-		VersionedParams(&options, metav1.ParameterCodec).
-		Do(ctx).
-		Into(result)
-	return
+	return c.invoke(ctx, &Request{
+		Verb:      VerbGet,
+		Namespace: namespace,
+		Name:      name,
+		Options:   &options,
+		Result:    result,
+	}, func(ctx context.Context, _ *Request) (err error) {
+		defer c.setKind(result)
+		ctx, cancel := c.setupCtx(ctx)
+		defer cancel()
+		err = c.restClient(result).Get().
+			Prefix(c.prefix...).
+			NamespaceIfScoped(namespace, c.Namespaced).
+			Resource(c.resource).
+			Name(name).
+			VersionedParams(&options, metav1.ParameterCodec).
+			Do(ctx).
+			Into(result)
+		return
+	})
 }
 
 // List will attempt to find resources in the given namespace (if client.Namespaced is set to true).
@@ -152,41 +212,62 @@ func (c *Client) Get(ctx context.Context, namespace, name string, result runtime
 // If the returned response object is of type Status and has .Status != StatusSuccess, the
 // additional information in Status will be used to enrich the error.
 func (c *Client) List(ctx context.Context, namespace string, result runtime.Object, opts metav1.ListOptions) (err error) {
-	ctx, cancel := c.setupCtx(ctx)
-	defer cancel()
-	var timeout time.Duration
-	if opts.TimeoutSeconds != nil {
-		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
-	}
-	r := c.RESTClient.Get()
-	if namespace != "" {
-		r = r.NamespaceIfScoped(namespace, c.Namespaced)
-	}
-	err = r.Resource(c.resource).
-		Prefix(c.prefix...).
-		VersionedParams(&opts, metav1.ParameterCodec).
-		Timeout(timeout).
-		Do(ctx).
-		Into(result)
-	return
+	return c.invoke(ctx, &Request{
+		Verb:      VerbList,
+		Namespace: namespace,
+		Options:   &opts,
+		Result:    result,
+	}, func(ctx context.Context, _ *Request) (err error) {
+		ctx, cancel := c.setupCtx(ctx)
+		defer cancel()
+		var timeout time.Duration
+		if opts.TimeoutSeconds != nil {
+			timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+		}
+		r := c.restClient(result).Get()
+		if namespace != "" {
+			r = r.NamespaceIfScoped(namespace, c.Namespaced)
+		}
+		err = r.Resource(c.resource).
+			Prefix(c.prefix...).
+			VersionedParams(&opts, metav1.ParameterCodec).
+			Timeout(timeout).
+			Do(ctx).
+			Into(result)
+		return
+	})
 }
 
 // Watch will attempt to start a watch request with the kube-apiserver for resources in the given namespace (if client.Namespaced is set to true).
 // Results will be streamed too the returned watch.Interface.
 // The returned watch.Interface is determine by *("k8s.io/client-go/rest").Request.Watch
+// The watched objects are of the types registered in the scheme, see WithUnstructured to get Unstructured objects.
 func (c *Client) Watch(ctx context.Context, namespace string, opts metav1.ListOptions) (watch.Interface, error) {
-	var timeout time.Duration
-	if opts.TimeoutSeconds != nil {
-		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
-	}
 	opts.Watch = true
-	return c.injectKind(c.RESTClient.Get().
-		Prefix(c.prefix...).
-		NamespaceIfScoped(namespace, c.Namespaced).
-		Resource(c.resource).
-		VersionedParams(&opts, metav1.ParameterCodec).
-		Timeout(timeout).
-		Watch(ctx))
+	req := &Request{
+		Verb:      VerbWatch,
+		Namespace: namespace,
+		Options:   &opts,
+	}
+	err := c.invoke(ctx, req, func(ctx context.Context, req *Request) error {
+		var timeout time.Duration
+		if opts.TimeoutSeconds != nil {
+			timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+		}
+		w, err := c.restClient().Get().
+			Prefix(c.prefix...).
+			NamespaceIfScoped(namespace, c.Namespaced).
+			Resource(c.resource).
+			VersionedParams(&opts, metav1.ParameterCodec).
+			Timeout(timeout).
+			Watch(ctx)
+		req.Watch, err = c.injectKind(ctx, w, err)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return req.Watch, nil
 }
 
 // Create will attempt create the provided object in the given namespace (if client.Namespaced is set to true).
@@ -194,18 +275,35 @@ func (c *Client) Watch(ctx context.Context, namespace string, opts metav1.ListOp
 // If the returned response object is of type Status and has .Status != StatusSuccess, the
 // additional information in Status will be used to enrich the error.
 func (c *Client) Create(ctx context.Context, namespace string, obj, result runtime.Object, opts metav1.CreateOptions) (err error) {
-	defer c.setKind(result)
-	ctx, cancel := c.setupCtx(ctx)
-	defer cancel()
-	err = c.RESTClient.Post().
-		Prefix(c.prefix...).
-		NamespaceIfScoped(namespace, c.Namespaced).
-		Resource(c.resource).
-		VersionedParams(&opts, metav1.ParameterCodec).
-		Body(obj).
-		Do(ctx).
-		Into(result)
-	return
+	var name string
+	if m, err := meta.Accessor(obj); err == nil {
+		name = m.GetName()
+	}
+	err = c.invoke(ctx, &Request{
+		Verb:      VerbCreate,
+		Namespace: namespace,
+		Name:      name,
+		Options:   &opts,
+		Body:      obj,
+		Result:    result,
+	}, func(ctx context.Context, _ *Request) (err error) {
+		defer c.setKind(result)
+		ctx, cancel := c.setupCtx(ctx)
+		defer cancel()
+		err = c.restClient(obj, result).Post().
+			Prefix(c.prefix...).
+			NamespaceIfScoped(namespace, c.Namespaced).
+			Resource(c.resource).
+			VersionedParams(&opts, metav1.ParameterCodec).
+			Body(obj).
+			Do(ctx).
+			Into(result)
+		return
+	})
+	if err != nil {
+		return err
+	}
+	return c.waitForWrite(ctx, result, opts.DryRun)
 }
 
 // Update will attempt update the provided object in the given namespace (if client.Namespaced is set to true).
@@ -213,23 +311,36 @@ func (c *Client) Create(ctx context.Context, namespace string, obj, result runti
 // If the returned response object is of type Status and has .Status != StatusSuccess, the
 // additional information in Status will be used to enrich the error.
 func (c *Client) Update(ctx context.Context, namespace string, obj, result runtime.Object, opts metav1.UpdateOptions) (err error) {
-	defer c.setKind(result)
-	ctx, cancel := c.setupCtx(ctx)
-	defer cancel()
 	m, err := meta.Accessor(obj)
 	if err != nil {
 		return err
 	}
-	err = c.RESTClient.Put().
-		Prefix(c.prefix...).
-		NamespaceIfScoped(namespace, c.Namespaced).
-		Resource(c.resource).
-		Name(m.GetName()).
-		VersionedParams(&opts, metav1.ParameterCodec).
-		Body(obj).
-		Do(ctx).
-		Into(result)
-	return
+	err = c.invoke(ctx, &Request{
+		Verb:      VerbUpdate,
+		Namespace: namespace,
+		Name:      m.GetName(),
+		Options:   &opts,
+		Body:      obj,
+		Result:    result,
+	}, func(ctx context.Context, _ *Request) (err error) {
+		defer c.setKind(result)
+		ctx, cancel := c.setupCtx(ctx)
+		defer cancel()
+		err = c.restClient(obj, result).Put().
+			Prefix(c.prefix...).
+			NamespaceIfScoped(namespace, c.Namespaced).
+			Resource(c.resource).
+			Name(m.GetName()).
+			VersionedParams(&opts, metav1.ParameterCodec).
+			Body(obj).
+			Do(ctx).
+			Into(result)
+		return
+	})
+	if err != nil {
+		return err
+	}
+	return c.waitForWrite(ctx, result, opts.DryRun)
 }
 
 // UpdateStatus will attempt update the status on the provided object in the given namespace (if client.Namespaced is set to true).
@@ -237,57 +348,84 @@ func (c *Client) Update(ctx context.Context, namespace string, obj, result runti
 // If the returned response object is of type Status and has .Status != StatusSuccess, the
 // additional information in Status will be used to enrich the error.
 func (c *Client) UpdateStatus(ctx context.Context, namespace string, obj, result runtime.Object, opts metav1.UpdateOptions) (err error) {
-	defer c.setKind(result)
-	ctx, cancel := c.setupCtx(ctx)
-	defer cancel()
 	m, err := meta.Accessor(obj)
 	if err != nil {
 		return err
 	}
-	err = c.RESTClient.Put().
-		Prefix(c.prefix...).
-		NamespaceIfScoped(namespace, c.Namespaced).
-		Resource(c.resource).
-		Name(m.GetName()).
-		SubResource("status").
-		VersionedParams(&opts, metav1.ParameterCodec).
-		Body(obj).
-		Do(ctx).
-		Into(result)
-	return
+	err = c.invoke(ctx, &Request{
+		Verb:        VerbUpdate,
+		Namespace:   namespace,
+		Name:        m.GetName(),
+		Subresource: "status",
+		Options:     &opts,
+		Body:        obj,
+		Result:      result,
+	}, func(ctx context.Context, _ *Request) (err error) {
+		defer c.setKind(result)
+		ctx, cancel := c.setupCtx(ctx)
+		defer cancel()
+		err = c.restClient(obj, result).Put().
+			Prefix(c.prefix...).
+			NamespaceIfScoped(namespace, c.Namespaced).
+			Resource(c.resource).
+			Name(m.GetName()).
+			SubResource("status").
+			VersionedParams(&opts, metav1.ParameterCodec).
+			Body(obj).
+			Do(ctx).
+			Into(result)
+		return
+	})
+	if err != nil {
+		return err
+	}
+	return c.waitForWrite(ctx, result, opts.DryRun)
 }
 
 // Delete will attempt to delete the resource with the matching name in the given namespace (if client.Namespaced is set to true).
 func (c *Client) Delete(ctx context.Context, namespace, name string, opts metav1.DeleteOptions) error {
-	ctx, cancel := c.setupCtx(ctx)
-	defer cancel()
-	return c.RESTClient.Delete().
-		Prefix(c.prefix...).
-		NamespaceIfScoped(namespace, c.Namespaced).
-		Resource(c.resource).
-		Name(name).
-		Body(&opts).
-		Do(ctx).
-		Error()
+	return c.invoke(ctx, &Request{
+		Verb:      VerbDelete,
+		Namespace: namespace,
+		Name:      name,
+		Options:   &opts,
+	}, func(ctx context.Context, _ *Request) error {
+		ctx, cancel := c.setupCtx(ctx)
+		defer cancel()
+		return c.RESTClient.Delete().
+			Prefix(c.prefix...).
+			NamespaceIfScoped(namespace, c.Namespaced).
+			Resource(c.resource).
+			Name(name).
+			Body(&opts).
+			Do(ctx).
+			Error()
+	})
 }
 
 // DeleteCollection will attempt to delete all resource the given namespace (if client.Namespaced is set to true).
 func (c *Client) DeleteCollection(ctx context.Context, namespace string, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error {
-	ctx, cancel := c.setupCtx(ctx)
-	defer cancel()
-	var timeout time.Duration
-	if listOpts.TimeoutSeconds != nil {
-		timeout = time.Duration(*listOpts.TimeoutSeconds) * time.Second
-	}
-	return c.RESTClient.Delete().
-		Prefix(c.prefix...).
-		NamespaceIfScoped(namespace, c.Namespaced).
-		Resource(c.resource).
-		VersionedParams(&listOpts, metav1.ParameterCodec).
-		Timeout(timeout).
-		Body(&opts).
-		Do(ctx).
-		Error()
+	return c.invoke(ctx, &Request{
+		Verb:      VerbDeleteCollection,
+		Namespace: namespace,
+		Options:   &opts,
+	}, func(ctx context.Context, _ *Request) error {
+		ctx, cancel := c.setupCtx(ctx)
+		defer cancel()
+		var timeout time.Duration
+		if listOpts.TimeoutSeconds != nil {
+			timeout = time.Duration(*listOpts.TimeoutSeconds) * time.Second
+		}
+		return c.RESTClient.Delete().
+			Prefix(c.prefix...).
+			NamespaceIfScoped(namespace, c.Namespaced).
+			Resource(c.resource).
+			VersionedParams(&listOpts, metav1.ParameterCodec).
+			Timeout(timeout).
+			Body(&opts).
+			Do(ctx).
+			Error()
+	})
 }
 
 // Patch attempts to patch the existing resource with the provided data and patchType that matches the given name in the given namespace (if client.Namespaced is set to true).
@@ -295,20 +433,56 @@ func (c *Client) DeleteCollection(ctx context.Context, namespace string, opts me
 // If the returned response object is of type Status and has .Status != StatusSuccess, the
 // additional information in Status will be used to enrich the error.
 func (c *Client) Patch(ctx context.Context, namespace, name string, pt types.PatchType, data []byte, result runtime.Object, opts metav1.PatchOptions, subresources ...string) (err error) {
-	defer c.setKind(result)
-	ctx, cancel := c.setupCtx(ctx)
-	defer cancel()
-	err = c.RESTClient.Patch(pt).
-		Prefix(c.prefix...).
-		Namespace(namespace).
-		Resource(c.resource).
-		Name(name).
-		SubResource(subresources...).
-		VersionedParams(&opts, metav1.ParameterCodec).
-		Body(data).
-		Do(ctx).
-		Into(result)
-	return
+	err = c.invoke(ctx, &Request{
+		Verb:        VerbPatch,
+		Namespace:   namespace,
+		Name:        name,
+		Subresource: strings.Join(subresources, "/"),
+		Options:     &opts,
+		PatchType:   pt,
+		Body:        data,
+		Result:      result,
+	}, func(ctx context.Context, _ *Request) (err error) {
+		defer c.setKind(result)
+		ctx, cancel := c.setupCtx(ctx)
+		defer cancel()
+		err = c.restClient(result).Patch(pt).
+			Prefix(c.prefix...).
+			Namespace(namespace).
+			Resource(c.resource).
+			Name(name).
+			SubResource(subresources...).
+			VersionedParams(&opts, metav1.ParameterCodec).
+			Body(data).
+			Do(ctx).
+			Into(result)
+		return
+	})
+	if err != nil {
+		return err
+	}
+	return c.waitForWrite(ctx, result, opts.DryRun)
+}
+
+// waitForWrite waits for the WriteWaiter to observe result. It is called once invoke returned, so that the metrics,
+// audit and retries of the interceptors only see the request itself.
+func (c *Client) waitForWrite(ctx context.Context, result runtime.Object, dryRun []string) error {
+	// dry-run writes are never persisted, hence never observed
+	if c.writeWaiter == nil || len(dryRun) > 0 {
+		return nil
+	}
+	m, err := meta.Accessor(result)
+	if err != nil {
+		return err
+	}
+	key := m.GetName()
+	if m.GetNamespace() != "" {
+		key = m.GetNamespace() + "/" + key
+	}
+	if err := c.writeWaiter.WaitForResourceVersion(ctx, key, m.GetResourceVersion()); err != nil {
+		return fmt.Errorf("waiting for the cache to observe %s %s: %w", c.GVR.Resource, key, err)
+	}
+	return nil
 }
 
 func (c *Client) setKind(obj runtime.Object) {
@@ -323,8 +497,11 @@ func (c *Client) setKind(obj runtime.Object) {
 	}
 }
 
-func (c *Client) injectKind(w watch.Interface, err error) (watch.Interface, error) {
-	if c.kind == "" || err != nil {
+// injectKind sets the kind of the client on the watched objects, converting them to Unstructured if the client is
+// unstructured. Its goroutine stops the wrapped watch and returns once ctx is done, even if the events are no longer
+// consumed.
+func (c *Client) injectKind(ctx context.Context, w watch.Interface, err error) (watch.Interface, error) {
+	if (c.kind == "" && !c.unstructured) || err != nil {
 		return w, err
 	}
 
@@ -332,9 +509,26 @@ func (c *Client) injectKind(w watch.Interface, err error) (watch.Interface, erro
 
 	go func() {
 		defer close(eventChan)
-		for event := range w.ResultChan() {
-			c.setKind(event.Object)
-			eventChan <- event
+		for {
+			select {
+			case event, ok := <-w.ResultChan():
+				if !ok {
+					return
+				}
+				c.setKind(event.Object)
+				if c.unstructured {
+					event = toUnstructuredEvent(event)
+				}
+				select {
+				case eventChan <- event:
+				case <-ctx.Done():
+					w.Stop()
+					return
+				}
+			case <-ctx.Done():
+				w.Stop()
+				return
+			}
 		}
 	}()
 
@@ -360,3 +554,21 @@ func (w *watcher) Stop() {
 func (w *watcher) ResultChan() <-chan watch.Event {
 	return w.eventChan
 }
+
+// toUnstructuredEvent converts the typed object of event to Unstructured, or turns the event into an Error event if it
+// cannot be converted
+func toUnstructuredEvent(event watch.Event) watch.Event {
+	switch event.Object.(type) {
+	case nil, runtime.Unstructured, *metav1.Status:
+		return event
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(event.Object)
+	if err != nil {
+		return watch.Event{
+			Type:   watch.Error,
+			Object: &apierrors.NewInternalError(fmt.Errorf("failed to convert watched %T to unstructured: %w", event.Object, err)).ErrStatus,
+		}
+	}
+	event.Object = &unstructured.Unstructured{Object: content}
+	return event
+}
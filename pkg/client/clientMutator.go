@@ -38,6 +38,18 @@ func NewSharedClientFactoryWithImpersonation(impersonate rest.ImpersonationConfi
 	}
 }
 
+// NewSharedClientFactoryWithInterceptors returns a sharedClientFactory that is equivalent to client factory with the addition
+// that the requests of the clients returned from ForKind, ForResource, and ForResourceKind go through the passed interceptors.
+func NewSharedClientFactoryWithInterceptors(clientFactory SharedClientFactory, interceptors ...Interceptor) SharedClientFactory {
+	interceptorMutator := func(c *Client) (*Client, error) {
+		return c.WithInterceptors(interceptors...), nil
+	}
+	return &sharedClientFactoryWithMutation{
+		SharedClientFactory: clientFactory,
+		mutator:             interceptorMutator,
+	}
+}
+
 // ForKind returns a newly mutated client for the provided GroupVersionKind.
 func (s *sharedClientFactoryWithMutation) ForKind(gvk schema.GroupVersionKind) (*Client, error) {
 	client, err := s.SharedClientFactory.ForKind(gvk)
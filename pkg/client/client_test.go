@@ -16,6 +16,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
@@ -389,6 +390,42 @@ func TestClient_Create(t *testing.T) {
 	}
 }
 
+func TestClient_WithWriteWaiter(t *testing.T) {
+	t.Parallel()
+
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	desired := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "foo",
+			Namespace:       "bar",
+			ResourceVersion: "42",
+		},
+	}
+	mockRESTClient := &fake.RESTClient{
+		GroupVersion:         gvr.GroupVersion(),
+		NegotiatedSerializer: negotiatedSerializer,
+	}
+	var waited []string
+	waitedInInterceptor := false
+	c := NewClient(gvr, "Pod", true, mockRESTClient, 0).WithWriteWaiter(WriteWaiterFunc(func(_ context.Context, key, resourceVersion string) error {
+		waited = append(waited, key+"@"+resourceVersion)
+		return nil
+	})).WithInterceptors(func(ctx context.Context, req *Request, next Invoker) error {
+		err := next(ctx, req)
+		waitedInInterceptor = len(waited) > 0
+		return err
+	})
+	mockRESTClient.Client = fake.CreateHTTPClient(newRequestHandler(c, desired, "bar", false, false))
+
+	require.NoError(t, c.Create(context.TODO(), "bar", desired, &v1.Pod{}, metav1.CreateOptions{}))
+	require.Equal(t, []string{"bar/foo@42"}, waited)
+	require.False(t, waitedInInterceptor, "interceptors do not see the wait for the cache")
+
+	// dry-run writes are never observed by caches
+	require.NoError(t, c.Create(context.TODO(), "bar", desired, &v1.Pod{}, metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}}))
+	require.Len(t, waited, 1)
+}
+
 func TestClient_Delete(t *testing.T) {
 	t.Parallel()
 	tests := []*testInfo{
@@ -540,7 +577,7 @@ func TestClient_Watch_Stop(t *testing.T) {
 	t.Parallel()
 	client := &Client{kind: "testkind"}
 	mockWatcher := watch.NewFake()
-	w, err := client.injectKind(mockWatcher, nil)
+	w, err := client.injectKind(context.TODO(), mockWatcher, nil)
 	require.NoError(t, err)
 
 	resultChan := w.ResultChan()
@@ -650,6 +687,96 @@ func TestClient_Patch(t *testing.T) {
 	}
 }
 
+func TestClient_Apply(t *testing.T) {
+	t.Parallel()
+
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	mockRESTClient := &fake.RESTClient{
+		GroupVersion:         gvr.GroupVersion(),
+		NegotiatedSerializer: negotiatedSerializer,
+	}
+	c := NewClient(gvr, "Pod", true, mockRESTClient, 0).WithFieldManager("default-manager")
+	mockRESTClient.Client = fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+		if req.Method != http.MethodPatch || req.Header.Get("Content-Type") != string(types.ApplyPatchType) {
+			return nil, fmt.Errorf("unexpected %s request with content type %s", req.Method, req.Header.Get("Content-Type"))
+		}
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		var obj map[string]any
+		if err := json.Unmarshal(body, &obj); err != nil {
+			return nil, err
+		}
+		retData, err := json.Marshal(map[string]any{
+			"apiVersion": obj["apiVersion"],
+			"kind":       obj["kind"],
+			"metadata": map[string]any{
+				"name":        "foo",
+				"namespace":   "bar",
+				"annotations": map[string]any{"path": req.URL.Path, "query": req.URL.RawQuery},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(bytes.NewReader(retData)),
+		}, nil
+	})
+
+	// typed objects are sent with the apiVersion and kind of the client
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "bar"}}
+	result := &v1.Pod{}
+	require.NoError(t, c.Apply(context.TODO(), "bar", pod, result, ApplyOptions{}))
+	require.Equal(t, "Pod", result.Kind)
+	require.Equal(t, "/api/v1/namespaces/bar/pods/foo", result.Annotations["path"])
+	require.Equal(t, "fieldManager=default-manager", result.Annotations["query"])
+
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("v1")
+	u.SetKind("Pod")
+	u.SetName("foo")
+	require.NoError(t, c.ApplyStatus(context.TODO(), "bar", u, result, ApplyOptions{FieldManager: "status-manager", Force: true}))
+	require.Equal(t, "/api/v1/namespaces/bar/pods/foo/status", result.Annotations["path"])
+	require.Equal(t, "fieldManager=status-manager&force=true", result.Annotations["query"])
+
+	require.Error(t, NewClient(gvr, "Pod", true, mockRESTClient, 0).Apply(context.TODO(), "bar", pod, result, ApplyOptions{}))
+}
+
+func TestClient_applyConfiguration_typed(t *testing.T) {
+	t.Parallel()
+
+	c := NewClient(schema.GroupVersionResource{Version: "v1", Resource: "pods"}, "Pod", true, nil, 0)
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "bar"},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{Name: "app", Image: "app:1"}},
+		},
+	}
+	u, err := c.applyConfiguration(pod)
+	require.NoError(t, err)
+	data, err := json.Marshal(u.Object)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"apiVersion": "v1",
+		"kind": "Pod",
+		"metadata": {"name": "foo", "namespace": "bar"},
+		"spec": {"containers": [{"name": "app", "image": "app:1"}]}
+	}`, string(data), "the zero values of typed objects are not applied")
+
+	// unstructured objects are applied as is
+	u = &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   map[string]any{"name": "foo", "labels": map[string]any{}},
+	}}
+	u, err = c.applyConfiguration(u)
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{}, u.Object["metadata"].(map[string]any)["labels"])
+}
+
 func TestClient_WithAgent(t *testing.T) {
 	gvr := schema.GroupVersionResource{
 		Group:    "",
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/runtime/serializer/cbor"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+)
+
+// cborAcceptContentTypes prefers CBOR responses, falling back to JSON for API servers not supporting it
+var cborAcceptContentTypes = runtime.ContentTypeCBOR + "," + runtime.ContentTypeJSON + ";q=0.9"
+
+// protobufAcceptContentTypes prefers protobuf responses, falling back to JSON for the resources not supporting it
+var protobufAcceptContentTypes = runtime.ContentTypeProtobuf + "," + runtime.ContentTypeJSON
+
+// codecFactory returns the codec factory of the clients, able to decode CBOR responses if acceptCBOR is set
+func codecFactory(scheme *runtime.Scheme, acceptCBOR bool) serializer.CodecFactory {
+	if acceptCBOR {
+		return serializer.NewCodecFactory(scheme, serializer.WithSerializer(cbor.NewSerializerInfo))
+	}
+	return serializer.NewCodecFactory(scheme)
+}
+
+// withCBOR returns a copy of config accepting CBOR responses. Request bodies are still sent as JSON, so requests do
+// not fail against API servers not supporting CBOR.
+func withCBOR(config *rest.Config) *rest.Config {
+	config = rest.CopyConfig(config)
+	config.AcceptContentTypes = cborAcceptContentTypes
+	return config
+}
+
+// protobufRESTClientFor returns a RESTClient sending and accepting protobuf, for the built-in types of Kubernetes
+func protobufRESTClientFor(config rest.Config) (rest.Interface, error) {
+	config.ContentType = runtime.ContentTypeProtobuf
+	config.AcceptContentTypes = protobufAcceptContentTypes
+	restClient, err := rest.UnversionedRESTClientFor(&config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create protobuf restClient: %w", err)
+	}
+	return restClient, nil
+}
+
+// supportsProtobuf returns whether gvk is a built-in type of Kubernetes, served as protobuf by the API server, that
+// scheme can decode
+func supportsProtobuf(scheme *runtime.Scheme, gvk schema.GroupVersionKind) bool {
+	return gvk.Kind != "" && clientgoscheme.Scheme.Recognizes(gvk) && scheme.Recognizes(gvk)
+}
+
+// restClient returns the RESTClient of a request sending and receiving the given objects. Requests of Unstructured
+// objects, and every request of unstructured clients, use JSON as Unstructured objects cannot be decoded from protobuf.
+func (c *Client) restClient(objs ...runtime.Object) rest.Interface {
+	if c.protobuf == nil || c.unstructured {
+		return c.RESTClient
+	}
+	for _, obj := range objs {
+		if _, ok := obj.(runtime.Unstructured); ok {
+			return c.RESTClient
+		}
+	}
+	return c.protobuf
+}
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientfeatures "k8s.io/client-go/features"
+	clientfeaturestesting "k8s.io/client-go/features/testing"
+	"k8s.io/client-go/rest"
+)
+
+func TestSharedClientFactory_ContentTypes(t *testing.T) {
+	// client-go only sends and decodes CBOR behind this feature gate
+	clientfeaturestesting.SetFeatureDuringTest(t, clientfeatures.ClientsAllowCBOR, true)
+
+	codecs := codecFactory(testSchema, true)
+	accepts := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		accepts[req.URL.Path] = req.Header.Get("Accept")
+		mediaType := strings.Split(req.Header.Get("Accept"), ",")[0]
+		info, ok := runtime.SerializerInfoForMediaType(codecs.SupportedMediaTypes(), mediaType)
+		require.True(t, ok, mediaType)
+
+		var obj runtime.Object = &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "bar"}}
+		gv := v1.SchemeGroupVersion
+		if strings.HasPrefix(req.URL.Path, "/apis/example.com/") {
+			obj = &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "example.com/v1",
+				"kind":       "Foo",
+				"metadata":   map[string]any{"name": "foo", "namespace": "bar"},
+			}}
+			gv = schema.GroupVersion{Group: "example.com", Version: "v1"}
+		}
+		w.Header().Set("Content-Type", info.MediaType)
+		require.NoError(t, codecs.EncoderForVersion(info.Serializer, gv).Encode(obj, w))
+	}))
+	t.Cleanup(server.Close)
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	f, err := NewSharedClientFactory(&rest.Config{Host: server.URL}, &SharedClientFactoryOptions{
+		Mapper:   mapper,
+		Scheme:   testSchema,
+		Protobuf: true,
+		CBOR:     true,
+	})
+	require.NoError(t, err)
+	pods := f.ForResourceKind(v1.SchemeGroupVersion.WithResource("pods"), "Pod", true)
+	foos := f.ForResourceKind(schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "foos"}, "Foo", true)
+
+	pod := &v1.Pod{}
+	require.NoError(t, pods.Get(context.TODO(), "bar", "foo", pod, metav1.GetOptions{}))
+	assert.Equal(t, "foo", pod.Name)
+	assert.Equal(t, protobufAcceptContentTypes, accepts["/api/v1/namespaces/bar/pods/foo"], "built-in types use protobuf")
+
+	obj := &unstructured.Unstructured{}
+	require.NoError(t, pods.Get(context.TODO(), "bar", "foo", obj, metav1.GetOptions{}))
+	assert.Equal(t, "foo", obj.GetName())
+	assert.Equal(t, cborAcceptContentTypes, accepts["/api/v1/namespaces/bar/pods/foo"], "Unstructured objects cannot use protobuf")
+
+	obj = &unstructured.Unstructured{}
+	require.NoError(t, foos.Get(context.TODO(), "bar", "foo", obj, metav1.GetOptions{}))
+	assert.Equal(t, "foo", obj.GetName())
+	assert.Equal(t, cborAcceptContentTypes, accepts["/apis/example.com/v1/namespaces/bar/foos/foo"], "CRDs cannot use protobuf")
+}
+
+func TestClient_WithUnstructured_Watch(t *testing.T) {
+	t.Parallel()
+
+	var accepts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		accepts = append(accepts, req.Header.Get("Accept"))
+		w.Header().Set("Content-Type", runtime.ContentTypeJSON)
+		_, _ = w.Write([]byte(`{"type":"ADDED","object":{"apiVersion":"v1","kind":"Pod","metadata":{"name":"foo","namespace":"bar","resourceVersion":"1"}}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	f, err := NewSharedClientFactory(&rest.Config{Host: server.URL}, &SharedClientFactoryOptions{
+		Mapper:   meta.NewDefaultRESTMapper(nil),
+		Scheme:   testSchema,
+		Protobuf: true,
+	})
+	require.NoError(t, err)
+	pods := f.ForResourceKind(v1.SchemeGroupVersion.WithResource("pods"), "Pod", true)
+
+	w, err := pods.WithUnstructured().Watch(context.TODO(), "bar", metav1.ListOptions{})
+	require.NoError(t, err)
+	event := <-w.ResultChan()
+	w.Stop()
+	obj, ok := event.Object.(*unstructured.Unstructured)
+	require.True(t, ok, "got %T", event.Object)
+	assert.Equal(t, "foo", obj.GetName())
+	assert.Equal(t, "Pod", obj.GetKind())
+
+	typed := NewTypedClient[*unstructured.Unstructured, *unstructured.UnstructuredList](pods)
+	tw, err := typed.Watch(context.TODO(), "bar", metav1.ListOptions{})
+	require.NoError(t, err)
+	typedEvent := <-tw.ResultChan()
+	tw.Stop()
+	require.NotNil(t, typedEvent.Object)
+	assert.Equal(t, "foo", typedEvent.Object.GetName())
+
+	for _, accept := range accepts {
+		assert.NotContains(t, accept, runtime.ContentTypeProtobuf, "unstructured watches use JSON")
+	}
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"path"
+
+	"github.com/rancher/lasso/pkg/log"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/diff"
+)
+
+// CurrentObjectFunc returns the current state of an object, for instance from a cache, or nil if it does not exist
+type CurrentObjectFunc func(ctx context.Context, gvr schema.GroupVersionResource, namespace, name string) (runtime.Object, error)
+
+// DryRunInterceptor turns every write into a dry-run write, which the API server validates and admits without
+// persisting it. Each suppressed write is logged with the diff between the object returned by current and the object
+// the write would have produced. Without current, writes are logged without a diff.
+func DryRunInterceptor(current CurrentObjectFunc) Interceptor {
+	return func(ctx context.Context, req *Request, next Invoker) error {
+		if !req.IsWrite() {
+			return next(ctx, req)
+		}
+		if !forceDryRun(req.Options) {
+			log.Errorf("dry-run: refusing %s %s %s/%s as it cannot be dry-run", req.Verb, requestResource(req), req.Namespace, req.Name)
+			return apierrors.NewBadRequest("lasso client in dry-run mode cannot dry-run this request")
+		}
+
+		var before runtime.Object
+		if current != nil && req.Name != "" && req.Verb != VerbCreate {
+			obj, err := current(ctx, req.GVR, req.Namespace, req.Name)
+			if err != nil {
+				log.Debugf("dry-run: failed to get the current %s %s/%s: %v", requestResource(req), req.Namespace, req.Name, err)
+			}
+			before = obj
+		}
+
+		if err := next(ctx, req); err != nil {
+			log.Infof("dry-run: %s %s %s/%s failed: %v", req.Verb, requestResource(req), req.Namespace, req.Name, err)
+			return err
+		}
+
+		after := req.Result
+		if req.Verb == VerbDelete || req.Verb == VerbDeleteCollection {
+			after = nil
+		}
+		log.Infof("dry-run: suppressed %s %s %s/%s%s", req.Verb, requestResource(req), req.Namespace, req.Name, objectDiff(before, after))
+		return nil
+	}
+}
+
+// forceDryRun sets the DryRun field of the options of a write, returning false for unknown options
+func forceDryRun(options any) bool {
+	dryRun := []string{metav1.DryRunAll}
+	switch opts := options.(type) {
+	case *metav1.CreateOptions:
+		opts.DryRun = dryRun
+	case *metav1.UpdateOptions:
+		opts.DryRun = dryRun
+	case *metav1.PatchOptions:
+		opts.DryRun = dryRun
+	case *metav1.DeleteOptions:
+		opts.DryRun = dryRun
+	default:
+		return false
+	}
+	return true
+}
+
+func requestResource(req *Request) string {
+	return path.Join(req.GVR.Group, req.GVR.Version, req.GVR.Resource, req.Subresource)
+}
+
+// objectDiff returns a unified diff of before and after, leaving out their managed fields
+func objectDiff(before, after runtime.Object) string {
+	if before == nil && after == nil {
+		return ""
+	}
+	return ":\n" + diff.Diff(diffable(before), diffable(after))
+}
+
+func diffable(obj runtime.Object) map[string]any {
+	if obj == nil {
+		return nil
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil
+	}
+	unstructured.RemoveNestedField(content, "metadata", "managedFields")
+	return content
+}
+
+// liveObjectFunc gets the current objects with the client, used when dry-run clients are given no CurrentObjectFunc
+func liveObjectFunc(c *Client) CurrentObjectFunc {
+	return func(ctx context.Context, _ schema.GroupVersionResource, namespace, name string) (runtime.Object, error) {
+		obj := &unstructured.Unstructured{}
+		err := c.Get(ctx, namespace, name, obj, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return obj, err
+	}
+}
@@ -0,0 +1,42 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/rancher/lasso/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestDryRunInterceptor(t *testing.T) {
+	var logs []string
+	infof := log.Infof
+	log.Infof = func(message string, obj ...interface{}) {
+		logs = append(logs, fmt.Sprintf(message, obj...))
+	}
+	t.Cleanup(func() {
+		log.Infof = infof
+	})
+
+	c, queries := newInterceptedClient(0)
+	c = c.WithInterceptors(DryRunInterceptor(func(_ context.Context, gvr schema.GroupVersionResource, namespace, name string) (runtime.Object, error) {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: map[string]string{"cached": "true"}}}, nil
+	}))
+
+	require.NoError(t, c.Get(context.TODO(), "bar", "foo", &v1.Pod{}, metav1.GetOptions{}))
+	require.NoError(t, c.Create(context.TODO(), "bar", &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "foo"}}, &v1.Pod{}, metav1.CreateOptions{}))
+	require.NoError(t, c.Patch(context.TODO(), "bar", "foo", types.MergePatchType, []byte(`{}`), &v1.Pod{}, metav1.PatchOptions{}))
+	assert.Equal(t, []string{"GET ", "POST dryRun=All", "PATCH dryRun=All"}, *queries)
+
+	require.Len(t, logs, 2, "reads are not logged")
+	assert.Contains(t, logs[0], "dry-run: suppressed create v1/pods bar/foo")
+	assert.Contains(t, logs[1], "dry-run: suppressed patch v1/pods bar/foo")
+	assert.Contains(t, logs[1], `-   "cached": "true"`)
+}
@@ -0,0 +1,192 @@
+package client
+
+import (
+	"context"
+	"io"
+	"math/rand/v2"
+	"path"
+	"time"
+
+	"github.com/rancher/lasso/pkg/log"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// The verbs of the requests seen by interceptors, named like the verbs of the Kubernetes authorization and audit
+const (
+	VerbGet              = "get"
+	VerbList             = "list"
+	VerbWatch            = "watch"
+	VerbCreate           = "create"
+	VerbUpdate           = "update"
+	VerbPatch            = "patch"
+	VerbDelete           = "delete"
+	VerbDeleteCollection = "deletecollection"
+)
+
+// Request describes a call of a Client to an interceptor
+type Request struct {
+	Verb        string
+	GVR         schema.GroupVersionResource
+	Namespace   string
+	Name        string
+	Subresource string
+	// Options points to the options of the call, such as *metav1.GetOptions. Interceptors may modify them.
+	Options any
+	// PatchType is the type of the patch of Patch requests
+	PatchType types.PatchType
+	// Body is the runtime.Object sent by Create and Update requests, or the []byte of Patch requests
+	Body any
+	// Result receives the object returned by the API server, if the call returns one
+	Result runtime.Object
+	// Watch is set to the started watch once a Watch request succeeded
+	Watch watch.Interface
+	// Stream is set to the opened stream once a StreamSubresource request succeeded
+	Stream io.ReadCloser
+}
+
+// IsWrite returns whether the request modifies resources
+func (r *Request) IsWrite() bool {
+	switch r.Verb {
+	case VerbGet, VerbList, VerbWatch:
+		return false
+	}
+	return true
+}
+
+// Invoker performs a request
+type Invoker func(ctx context.Context, req *Request) error
+
+// Interceptor wraps the requests of a Client, performing the request by calling next. An interceptor may modify the
+// request before calling next, call next several times, or not at all.
+type Interceptor func(ctx context.Context, req *Request, next Invoker) error
+
+// Chain composes interceptors into one, the first interceptor being the outermost
+func Chain(interceptors ...Interceptor) Interceptor {
+	return func(ctx context.Context, req *Request, next Invoker) error {
+		return chainInvoker(interceptors, next)(ctx, req)
+	}
+}
+
+func chainInvoker(interceptors []Interceptor, invoker Invoker) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, req *Request) error {
+			return interceptor(ctx, req, next)
+		}
+	}
+	return invoker
+}
+
+// WithInterceptors returns a copy of the Client whose requests go through the given interceptors, after the
+// interceptors of the Client. The first interceptor is the outermost. The dry-run and rate limit of the factory still
+// apply after them.
+func (c *Client) WithInterceptors(interceptors ...Interceptor) *Client {
+	client := *c
+	client.interceptors = append(append([]Interceptor(nil), c.interceptors...), interceptors...)
+	return &client
+}
+
+func (c *Client) invoke(ctx context.Context, req *Request, invoker Invoker) error {
+	req.GVR = c.GVR
+	invoker = instrument(invoker)
+	if c.rateLimit != nil {
+		invoker = chainInvoker([]Interceptor{c.rateLimit}, invoker)
+	}
+	if c.dryRun != nil {
+		invoker = chainInvoker([]Interceptor{c.dryRun}, invoker)
+	}
+	return chainInvoker(c.interceptors, invoker)(ctx, req)
+}
+
+// MetricsInterceptor calls observe once each request completed, with its duration and error
+func MetricsInterceptor(observe func(req *Request, duration time.Duration, err error)) Interceptor {
+	return func(ctx context.Context, req *Request, next Invoker) error {
+		start := time.Now()
+		err := next(ctx, req)
+		observe(req, time.Since(start), err)
+		return err
+	}
+}
+
+// AuditInterceptor logs the write requests with logf, defaulting to log.Infof if nil
+func AuditInterceptor(logf func(message string, obj ...interface{})) Interceptor {
+	if logf == nil {
+		logf = log.Infof
+	}
+	return func(ctx context.Context, req *Request, next Invoker) error {
+		if !req.IsWrite() {
+			return next(ctx, req)
+		}
+		start := time.Now()
+		err := next(ctx, req)
+		resource := path.Join(req.GVR.Group, req.GVR.Version, req.GVR.Resource, req.Subresource)
+		logf("audit: %s %s %s/%s in %v: %s", req.Verb, resource, req.Namespace, req.Name, time.Since(start), requestOutcome(err))
+		return err
+	}
+}
+
+func requestOutcome(err error) string {
+	if err == nil {
+		return "succeeded"
+	}
+	return "failed: " + err.Error()
+}
+
+// RetryInterceptor retries the requests failing with a transient error, waiting according to backoff or to the delay
+// suggested by the API server. Requests rejected before being processed, such as when throttled, are retried for every
+// verb, while timeouts and connection errors are only retried for reads. Watches are never retried, see
+// Client.WatchResumable.
+func RetryInterceptor(backoff wait.Backoff) Interceptor {
+	return func(ctx context.Context, req *Request, next Invoker) error {
+		if req.Verb == VerbWatch {
+			return next(ctx, req)
+		}
+		b := backoff
+		for {
+			err := next(ctx, req)
+			if err == nil || b.Steps <= 1 || !retriable(req, err) {
+				return err
+			}
+			delay := b.Step()
+			if seconds, ok := apierrors.SuggestsClientDelay(err); ok {
+				delay = time.Duration(seconds) * time.Second
+			}
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return err
+			}
+		}
+	}
+}
+
+func retriable(req *Request, err error) bool {
+	if apierrors.IsTooManyRequests(err) || apierrors.IsServiceUnavailable(err) {
+		return true
+	}
+	if req.IsWrite() {
+		return false
+	}
+	return apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) || apierrors.IsInternalError(err) ||
+		utilnet.IsConnectionReset(err) || utilnet.IsProbableEOF(err)
+}
+
+// FaultInjectionInterceptor fails the given ratio of the requests, between 0 and 1, with the error returned by fault
+// instead of performing them. A nil error returned by fault lets the request through. It is meant for testing how
+// controllers handle API errors.
+func FaultInjectionInterceptor(ratio float64, fault func(req *Request) error) Interceptor {
+	return func(ctx context.Context, req *Request, next Invoker) error {
+		if rand.Float64() < ratio {
+			if err := fault(req); err != nil {
+				return err
+			}
+		}
+		return next(ctx, req)
+	}
+}
@@ -0,0 +1,131 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest/fake"
+)
+
+// newInterceptedClient returns a client whose requests fail with a 429 for the first failures, and their queries
+func newInterceptedClient(failures int) (*Client, *[]string) {
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	mockRESTClient := &fake.RESTClient{
+		GroupVersion:         gvr.GroupVersion(),
+		NegotiatedSerializer: negotiatedSerializer,
+	}
+	var queries []string
+	mockRESTClient.Client = fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+		queries = append(queries, req.Method+" "+req.URL.RawQuery)
+		var body any = &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "bar"}}
+		code := http.StatusOK
+		if len(queries) <= failures {
+			code = http.StatusTooManyRequests
+			body = &metav1.Status{
+				TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Status"},
+				Status:   metav1.StatusFailure,
+				Code:     http.StatusTooManyRequests,
+				Reason:   metav1.StatusReasonTooManyRequests,
+			}
+		}
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		return &http.Response{
+			StatusCode: code,
+			Header:     http.Header{"Content-Type": []string{runtime.ContentTypeJSON}},
+			Body:       io.NopCloser(bytes.NewReader(data)),
+		}, nil
+	})
+	return NewClient(gvr, "Pod", true, mockRESTClient, 0), &queries
+}
+
+func TestClient_WithInterceptors(t *testing.T) {
+	t.Parallel()
+
+	c, queries := newInterceptedClient(0)
+	var calls []string
+	record := func(name string) Interceptor {
+		return func(ctx context.Context, req *Request, next Invoker) error {
+			calls = append(calls, name+" "+req.Verb+" "+req.GVR.Resource+" "+req.Namespace+"/"+req.Name)
+			return next(ctx, req)
+		}
+	}
+	forceDryRun := func(ctx context.Context, req *Request, next Invoker) error {
+		if opts, ok := req.Options.(*metav1.CreateOptions); ok {
+			opts.DryRun = []string{metav1.DryRunAll}
+		}
+		return next(ctx, req)
+	}
+	c = c.WithInterceptors(record("outer")).WithInterceptors(Chain(record("inner"), forceDryRun))
+
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "foo"}}
+	result := &v1.Pod{}
+	require.NoError(t, c.Create(context.TODO(), "bar", pod, result, metav1.CreateOptions{}))
+	assert.Equal(t, "foo", result.Name)
+	assert.Equal(t, []string{"outer create pods bar/foo", "inner create pods bar/foo"}, calls)
+	assert.Equal(t, []string{"POST dryRun=All"}, *queries)
+}
+
+func TestRetryInterceptor(t *testing.T) {
+	t.Parallel()
+
+	backoff := wait.Backoff{Duration: time.Millisecond, Steps: 3}
+	c, queries := newInterceptedClient(2)
+	c = c.WithInterceptors(RetryInterceptor(backoff))
+	require.NoError(t, c.Delete(context.TODO(), "bar", "foo", metav1.DeleteOptions{}))
+	assert.Len(t, *queries, 3)
+
+	c, queries = newInterceptedClient(5)
+	c = c.WithInterceptors(RetryInterceptor(backoff))
+	err := c.Get(context.TODO(), "bar", "foo", &v1.Pod{}, metav1.GetOptions{})
+	assert.True(t, apierrors.IsTooManyRequests(err))
+	assert.Len(t, *queries, 3)
+}
+
+func TestFaultInjectionAndAuditInterceptors(t *testing.T) {
+	t.Parallel()
+
+	c, queries := newInterceptedClient(0)
+	var logs []string
+	var observed []error
+	c = c.WithInterceptors(
+		MetricsInterceptor(func(_ *Request, _ time.Duration, err error) {
+			observed = append(observed, err)
+		}),
+		AuditInterceptor(func(message string, obj ...interface{}) {
+			logs = append(logs, fmt.Sprintf(message, obj...))
+		}),
+		FaultInjectionInterceptor(1, func(req *Request) error {
+			if req.Verb == VerbDelete {
+				return apierrors.NewInternalError(fmt.Errorf("injected"))
+			}
+			return nil
+		}),
+	)
+
+	require.NoError(t, c.Get(context.TODO(), "bar", "foo", &v1.Pod{}, metav1.GetOptions{}))
+	require.Error(t, c.Delete(context.TODO(), "bar", "foo", metav1.DeleteOptions{}))
+	assert.Len(t, *queries, 1, "the injected fault must prevent the request")
+	require.Len(t, observed, 2)
+	assert.NoError(t, observed[0])
+	assert.Error(t, observed[1])
+	require.Len(t, logs, 1, "reads are not audited")
+	assert.Contains(t, logs[0], "audit: delete v1/pods bar/foo")
+	assert.Contains(t, logs[0], "injected")
+}
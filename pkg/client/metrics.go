@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rancher/lasso/pkg/metrics"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// instrument reports every request performed by invoker to the client metrics, including each attempt of the requests
+// retried by interceptors. Requests prevented by interceptors are not reported as they never reached the API server.
+func instrument(invoker Invoker) Invoker {
+	if !metrics.Enabled() {
+		return invoker
+	}
+	return func(ctx context.Context, req *Request) error {
+		start := time.Now()
+		err := invoker(ctx, req)
+		ctxID := metrics.ContextID(ctx)
+		metrics.ReportClientRequest(ctxID, req.GVR, req.Verb, responseCode(req.Verb, err), time.Since(start).Seconds())
+		if err == nil && req.Watch != nil {
+			gvr := req.GVR
+			req.Watch = newTimedWatcher(ctx, req.Watch, func(duration time.Duration) {
+				metrics.ReportClientWatchDuration(ctxID, gvr, duration.Seconds())
+			})
+		}
+		return err
+	}
+}
+
+// responseCode returns the HTTP status code of the response to a request, or "<error>" if there was no response
+func responseCode(verb string, err error) string {
+	if err == nil {
+		if verb == VerbCreate {
+			return strconv.Itoa(http.StatusCreated)
+		}
+		return strconv.Itoa(http.StatusOK)
+	}
+	var apiStatus apierrors.APIStatus
+	if errors.As(err, &apiStatus) && apiStatus.Status().Code != 0 {
+		return strconv.Itoa(int(apiStatus.Status().Code))
+	}
+	return "<error>"
+}
+
+// timedWatcher calls done with the duration of the watch once its events end, or ctx is done
+type timedWatcher struct {
+	wrapped   watch.Interface
+	eventChan chan watch.Event
+}
+
+func newTimedWatcher(ctx context.Context, w watch.Interface, done func(duration time.Duration)) watch.Interface {
+	start := time.Now()
+	eventChan := make(chan watch.Event)
+	go func() {
+		defer func() {
+			close(eventChan)
+			done(time.Since(start))
+		}()
+		for event := range w.ResultChan() {
+			select {
+			case eventChan <- event:
+			case <-ctx.Done():
+				w.Stop()
+				return
+			}
+		}
+	}()
+	return &timedWatcher{
+		wrapped:   w,
+		eventChan: eventChan,
+	}
+}
+
+func (w *timedWatcher) Stop() {
+	w.wrapped.Stop()
+	// Drain eventChan until the processing goroutine closes it, propagated from the original ResultChan
+	for range w.eventChan {
+	}
+}
+
+// ResultChan returns a receive only channel of watch events.
+func (w *timedWatcher) ResultChan() <-chan watch.Event {
+	return w.eventChan
+}
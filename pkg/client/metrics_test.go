@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rancher/lasso/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+func TestClient_Metrics(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	metrics.MustRegister(reg)
+
+	ctx := metrics.WithContextID(context.Background(), "test-ctx")
+	c, _ := newInterceptedClient(1)
+	require.Error(t, c.Get(ctx, "bar", "foo", &v1.Pod{}, metav1.GetOptions{}))
+	require.NoError(t, c.Get(ctx, "bar", "foo", &v1.Pod{}, metav1.GetOptions{}))
+	require.NoError(t, c.Create(ctx, "bar", &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "foo"}}, &v1.Pod{}, metav1.CreateOptions{}))
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP lasso_client_requests_total Total count of API requests sent by clients
+# TYPE lasso_client_requests_total counter
+lasso_client_requests_total{code="200",ctx="test-ctx",group="",resource="pods",verb="get",version="v1"} 1
+lasso_client_requests_total{code="201",ctx="test-ctx",group="",resource="pods",verb="create",version="v1"} 1
+lasso_client_requests_total{code="429",ctx="test-ctx",group="",resource="pods",verb="get",version="v1"} 1
+`), "lasso_client_requests_total"))
+
+	limited := c.WithInterceptors(RateLimitInterceptor(flowcontrol.NewTokenBucketRateLimiter(100, 10)))
+	require.NoError(t, limited.Get(ctx, "bar", "foo", &v1.Pod{}, metav1.GetOptions{}))
+	count, err := testutil.GatherAndCount(reg, "lasso_client_throttle_duration_seconds")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestTimedWatcher(t *testing.T) {
+	t.Parallel()
+
+	fakeWatcher := watch.NewFake()
+	done := make(chan time.Duration, 1)
+	w := newTimedWatcher(context.Background(), fakeWatcher, func(duration time.Duration) {
+		done <- duration
+	})
+
+	go fakeWatcher.Add(&v1.Pod{})
+	event := <-w.ResultChan()
+	assert.Equal(t, watch.Added, event.Type)
+
+	w.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the duration of the stopped watch was not reported")
+	}
+}
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"reflect"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DefaultPageLimit is the number of objects requested per page by ListPages and ListAll if the options set no limit
+const DefaultPageLimit = 500
+
+var errStopIteration = errors.New("iteration stopped")
+
+// ErrListRestarted is yielded by ListAll when the list restarted from the beginning, see ListPages
+var ErrListRestarted = errors.New("the continue token expired, the list restarted from the beginning")
+
+// ListPages lists the resources in the given namespace (if client.Namespaced is set to true) one page at a time, calling
+// pageFn with each page. list is only used for its type, every page being decoded into a new list of the same type.
+//
+// If the continue token expires while paging, the whole list is done again from the latest resourceVersion, and
+// pageFn is called with restarted set on its first page: the pages received before come from an older snapshot and
+// must be discarded.
+func (c *Client) ListPages(ctx context.Context, namespace string, list runtime.Object, opts metav1.ListOptions, pageFn func(page runtime.Object, restarted bool) error) error {
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultPageLimit
+	}
+
+	restarted := false
+	for {
+		page := reflect.New(reflect.TypeOf(list).Elem()).Interface().(runtime.Object)
+		err := c.List(ctx, namespace, page, opts)
+		if (apierrors.IsResourceExpired(err) || apierrors.IsGone(err)) && opts.Continue != "" {
+			opts.Continue = ""
+			opts.ResourceVersion = ""
+			opts.ResourceVersionMatch = ""
+			restarted = true
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := pageFn(page, restarted); err != nil {
+			return err
+		}
+		restarted = false
+
+		listMeta, err := meta.ListAccessor(page)
+		if err != nil {
+			return err
+		}
+		if listMeta.GetContinue() == "" {
+			return nil
+		}
+		// the resourceVersion is part of the continue token and may not be set with it
+		opts.Continue = listMeta.GetContinue()
+		opts.ResourceVersion = ""
+		opts.ResourceVersionMatch = ""
+	}
+}
+
+// ListAll returns an iterator over the resources in the given namespace (if client.Namespaced is set to true), listed
+// one page at a time by ListPages so only one page is held in memory. If the list restarts, ErrListRestarted is
+// yielded with a nil object and the iteration goes on with every object again, so the objects yielded before must be
+// discarded. Any other error ends the iteration, being yielded with a nil object.
+func (c *Client) ListAll(ctx context.Context, namespace string, list runtime.Object, opts metav1.ListOptions) iter.Seq2[runtime.Object, error] {
+	return func(yield func(runtime.Object, error) bool) {
+		err := c.ListPages(ctx, namespace, list, opts, func(page runtime.Object, restarted bool) error {
+			if restarted && !yield(nil, ErrListRestarted) {
+				return errStopIteration
+			}
+			items, err := meta.ExtractList(page)
+			if err != nil {
+				return err
+			}
+			for _, item := range items {
+				if !yield(item, nil) {
+					return errStopIteration
+				}
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopIteration) {
+			yield(nil, err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest/fake"
+)
+
+// newPagingClient returns a client listing count pods, pages being continued by the index of their first pod. The
+// continue token of the given index expires once.
+func newPagingClient(count, expiredIndex int) (*Client, *[]string) {
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	mockRESTClient := &fake.RESTClient{
+		GroupVersion:         gvr.GroupVersion(),
+		NegotiatedSerializer: negotiatedSerializer,
+	}
+	var requests []string
+	expired := false
+	mockRESTClient.Client = fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+		query := req.URL.Query()
+		requests = append(requests, query.Encode())
+		limit, err := strconv.Atoi(query.Get("limit"))
+		if err != nil {
+			return nil, err
+		}
+		start := 0
+		if token := query.Get("continue"); token != "" {
+			start, _ = strconv.Atoi(token)
+		}
+
+		var body any
+		code := http.StatusOK
+		if start == expiredIndex && !expired {
+			expired = true
+			code = http.StatusGone
+			body = &metav1.Status{
+				TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Status"},
+				Status:   metav1.StatusFailure,
+				Code:     http.StatusGone,
+				Reason:   metav1.StatusReasonExpired,
+			}
+		} else {
+			list := &v1.PodList{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "PodList"}}
+			for i := start; i < count && i < start+limit; i++ {
+				list.Items = append(list.Items, v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: fmt.Sprintf("pod-%03d", i)}})
+			}
+			if start+limit < count {
+				list.Continue = strconv.Itoa(start + limit)
+			}
+			body = list
+		}
+
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		return &http.Response{
+			StatusCode: code,
+			Header:     http.Header{"Content-Type": []string{runtime.ContentTypeJSON}},
+			Body:       io.NopCloser(bytes.NewReader(data)),
+		}, nil
+	})
+	return NewClient(gvr, "Pod", true, mockRESTClient, 0), &requests
+}
+
+func TestClient_ListPages(t *testing.T) {
+	t.Parallel()
+
+	c, requests := newPagingClient(10, -1)
+	var sizes []int
+	err := c.ListPages(context.TODO(), "ns", &v1.PodList{}, metav1.ListOptions{Limit: 4}, func(page runtime.Object, restarted bool) error {
+		assert.False(t, restarted)
+		sizes = append(sizes, len(page.(*v1.PodList).Items))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{4, 4, 2}, sizes)
+	assert.Len(t, *requests, 3)
+
+	c, requests = newPagingClient(3, -1)
+	err = c.ListPages(context.TODO(), "ns", &v1.PodList{}, metav1.ListOptions{}, func(runtime.Object, bool) error { return nil })
+	require.NoError(t, err)
+	assert.Equal(t, []string{"limit=" + strconv.Itoa(DefaultPageLimit)}, *requests)
+}
+
+func TestClient_ListAll(t *testing.T) {
+	t.Parallel()
+
+	// the token of the second page expires, the list restarting from the first pod
+	c, requests := newPagingClient(10, 4)
+	var names []string
+	restarts := 0
+	for obj, err := range c.ListAll(context.TODO(), "ns", &v1.PodList{}, metav1.ListOptions{Limit: 4}) {
+		if errors.Is(err, ErrListRestarted) {
+			restarts++
+			names = nil
+			continue
+		}
+		require.NoError(t, err)
+		names = append(names, obj.(*v1.Pod).Name)
+	}
+	assert.Equal(t, 1, restarts)
+	require.Len(t, names, 10)
+	for i, name := range names {
+		assert.Equal(t, fmt.Sprintf("pod-%03d", i), name)
+	}
+	assert.Len(t, *requests, 5)
+
+	// breaking out of the loop stops listing
+	c, requests = newPagingClient(10, -1)
+	for range c.ListAll(context.TODO(), "ns", &v1.PodList{}, metav1.ListOptions{Limit: 4}) {
+		break
+	}
+	assert.Len(t, *requests, 1)
+}
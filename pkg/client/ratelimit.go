@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rancher/lasso/pkg/metrics"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// RateLimit is a client-side token bucket shared by the requests of a resource, or of every resource of a group
+type RateLimit struct {
+	// GroupResource selects the requests of the bucket, every resource of the group if Resource is empty
+	GroupResource schema.GroupResource
+	QPS           float32
+	Burst         int
+	// Reserved gives the resources a budget of their own: their requests are only limited by this bucket, and not by
+	// the rate limiter of the REST client shared by every client, so bursts of other requests cannot starve them.
+	Reserved bool
+}
+
+type rateLimit struct {
+	RateLimit
+	limiter flowcontrol.RateLimiter
+}
+
+func newRateLimits(limits []RateLimit) ([]*rateLimit, error) {
+	var result []*rateLimit
+	for _, limit := range limits {
+		if limit.QPS <= 0 || limit.Burst <= 0 {
+			return nil, fmt.Errorf("invalid rate limit of [%s]: QPS and Burst must be positive", limit.GroupResource)
+		}
+		result = append(result, &rateLimit{
+			RateLimit: limit,
+			limiter:   flowcontrol.NewTokenBucketRateLimiter(limit.QPS, limit.Burst),
+		})
+	}
+	return result, nil
+}
+
+// rateLimitFor returns the rate limit of the resource if any, else the rate limit of its group
+func rateLimitFor(limits []*rateLimit, gr schema.GroupResource) *rateLimit {
+	var groupLimit *rateLimit
+	for _, limit := range limits {
+		switch limit.GroupResource {
+		case gr:
+			return limit
+		case schema.GroupResource{Group: gr.Group}:
+			if groupLimit == nil {
+				groupLimit = limit
+			}
+		}
+	}
+	return groupLimit
+}
+
+func hasReservedRateLimit(limits []*rateLimit) bool {
+	for _, limit := range limits {
+		if limit.Reserved {
+			return true
+		}
+	}
+	return false
+}
+
+// unlimitedConfig returns a copy of config without rate limiter, for the clients of reserved rate limits
+func unlimitedConfig(config *rest.Config) *rest.Config {
+	config = rest.CopyConfig(config)
+	config.RateLimiter = flowcontrol.NewFakeAlwaysRateLimiter()
+	return config
+}
+
+// RateLimitInterceptor waits for limiter before every request, including each attempt of retried requests. The wait
+// is reported to the client metrics.
+func RateLimitInterceptor(limiter flowcontrol.RateLimiter) Interceptor {
+	return func(ctx context.Context, req *Request, next Invoker) error {
+		start := time.Now()
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+		metrics.ReportClientThrottleDuration(metrics.ContextID(ctx), req.GVR, time.Since(start).Seconds())
+		return next(ctx, req)
+	}
+}
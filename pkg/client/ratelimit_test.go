@@ -0,0 +1,92 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+func TestRateLimitInterceptor(t *testing.T) {
+	t.Parallel()
+
+	c, queries := newInterceptedClient(0)
+	c = c.WithInterceptors(RateLimitInterceptor(flowcontrol.NewTokenBucketRateLimiter(0.001, 1)))
+
+	require.NoError(t, c.Get(context.TODO(), "bar", "foo", &v1.Pod{}, metav1.GetOptions{}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Error(t, c.Get(ctx, "bar", "foo", &v1.Pod{}, metav1.GetOptions{}), "the bucket is empty")
+	assert.Len(t, *queries, 1, "throttled requests are not sent")
+}
+
+func TestSharedClientFactory_RateLimits(t *testing.T) {
+	t.Parallel()
+
+	opts := &SharedClientFactoryOptions{
+		Mapper: meta.NewDefaultRESTMapper(nil),
+		Scheme: testSchema,
+		RateLimits: []RateLimit{
+			{GroupResource: schema.GroupResource{Resource: "secrets"}, QPS: 1, Burst: 1},
+			{GroupResource: schema.GroupResource{Group: "coordination.k8s.io"}, QPS: 10, Burst: 10, Reserved: true},
+			{GroupResource: schema.GroupResource{Group: "coordination.k8s.io", Resource: "leasecandidates"}, QPS: 1, Burst: 1},
+		},
+	}
+	f, err := NewSharedClientFactory(&rest.Config{Host: "https://localhost:6443"}, opts)
+	require.NoError(t, err)
+
+	pods := f.ForResourceKind(v1.SchemeGroupVersion.WithResource("pods"), "Pod", true)
+	secrets := f.ForResourceKind(v1.SchemeGroupVersion.WithResource("secrets"), "Secret", true)
+	leases := f.ForResourceKind(schema.GroupVersionResource{Group: "coordination.k8s.io", Version: "v1", Resource: "leases"}, "Lease", true)
+	candidates := f.ForResourceKind(schema.GroupVersionResource{Group: "coordination.k8s.io", Version: "v1alpha2", Resource: "leasecandidates"}, "LeaseCandidate", true)
+
+	assert.Nil(t, pods.rateLimit, "resources without rate limit")
+	assert.NotNil(t, secrets.rateLimit)
+	assert.Same(t, pods.RESTClient, secrets.RESTClient, "not reserved")
+	assert.Nil(t, secrets.Config.RateLimiter)
+
+	assert.NotNil(t, leases.rateLimit)
+	assert.NotSame(t, pods.RESTClient, leases.RESTClient, "reserved for the group")
+	assert.NotNil(t, leases.Config.RateLimiter, "clients derived with WithAgent stay unlimited")
+
+	assert.NotNil(t, candidates.rateLimit)
+	assert.Same(t, pods.RESTClient, candidates.RESTClient, "the rate limit of the resource overrides the one of its group")
+
+	opts.RateLimits = []RateLimit{{GroupResource: schema.GroupResource{Resource: "secrets"}, QPS: 1}}
+	_, err = NewSharedClientFactory(&rest.Config{Host: "https://localhost:6443"}, opts)
+	assert.Error(t, err, "Burst must be positive")
+}
+
+// countingLimiter counts the waits of a rate limiter that never throttles
+type countingLimiter struct {
+	flowcontrol.RateLimiter
+	waits int
+}
+
+func (l *countingLimiter) Wait(ctx context.Context) error {
+	l.waits++
+	return l.RateLimiter.Wait(ctx)
+}
+
+func TestRateLimitInterceptor_innermost(t *testing.T) {
+	t.Parallel()
+
+	c, queries := newInterceptedClient(2)
+	limiter := &countingLimiter{RateLimiter: flowcontrol.NewFakeAlwaysRateLimiter()}
+	c.rateLimit = RateLimitInterceptor(limiter)
+	c = c.WithInterceptors(RetryInterceptor(wait.Backoff{Duration: time.Millisecond, Steps: 3}))
+
+	require.NoError(t, c.Get(context.TODO(), "bar", "foo", &v1.Pod{}, metav1.GetOptions{}))
+	assert.Len(t, *queries, 3)
+	assert.Equal(t, 3, limiter.waits, "every attempt of the interceptors added later waits for the rate limit")
+}
@@ -0,0 +1,172 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/rancher/lasso/pkg/log"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// HistoryExpired is the type of the last event of a WatchResumable watch, sent when the resourceVersion to resume from
+// is no longer available, or when there is none as the watch started without resourceVersion and was closed before
+// its first event. The object of the event is the *metav1.Status returned by the API server, or a 410 Expired one. The
+// resources must then be listed again before starting a new watch.
+const HistoryExpired watch.EventType = "HISTORY_EXPIRED"
+
+var (
+	resumableWatchInitialBackoff = time.Second
+	resumableWatchMaxBackoff     = 30 * time.Second
+)
+
+// WatchResumable is like Watch, but resumes the watch from the last received resourceVersion whenever it is closed by
+// a disconnection or a timeout, backing off while reconnecting fails. Bookmarks are requested so the resourceVersion is
+// kept recent, and passed on with the other events. The watch only ends once stopped, ctx is done, or after sending a
+// HistoryExpired event.
+func (c *Client) WatchResumable(ctx context.Context, namespace string, opts metav1.ListOptions) (watch.Interface, error) {
+	opts.AllowWatchBookmarks = true
+	ctx, cancel := context.WithCancel(ctx)
+	w, err := c.Watch(ctx, namespace, opts)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	r := &resumableWatcher{
+		cancel:    cancel,
+		eventChan: make(chan watch.Event),
+	}
+	go r.run(ctx, c, namespace, opts, w)
+	return r, nil
+}
+
+type resumableWatcher struct {
+	cancel    func()
+	eventChan chan watch.Event
+}
+
+func (r *resumableWatcher) Stop() {
+	r.cancel()
+	// Drain eventChan until the processing goroutine closes it
+	for range r.eventChan {
+	}
+}
+
+// ResultChan returns a receive only channel of watch events.
+func (r *resumableWatcher) ResultChan() <-chan watch.Event {
+	return r.eventChan
+}
+
+func (r *resumableWatcher) run(ctx context.Context, c *Client, namespace string, opts metav1.ListOptions, w watch.Interface) {
+	defer close(r.eventChan)
+
+	backoff := newResumableWatchBackoff()
+	for {
+		received, err := r.forward(ctx, w, &opts)
+		w.Stop()
+		if ctx.Err() != nil {
+			return
+		}
+		if received {
+			backoff = newResumableWatchBackoff()
+		}
+
+		// watches closed right away, or failing, are resumed after a backoff
+		delay := !received || err != nil
+		for {
+			if isHistoryExpired(err) {
+				r.send(ctx, historyExpiredEvent(err))
+				return
+			}
+			// resuming without resourceVersion would start from now, missing the events of the gap
+			if opts.ResourceVersion == "" || opts.ResourceVersion == "0" {
+				r.send(ctx, historyExpiredEvent(apierrors.NewResourceExpired("no resourceVersion to resume the watch from")))
+				return
+			}
+			if delay {
+				log.Debugf("resuming watch of %s from resourceVersion %q: %v", c.GVR.Resource, opts.ResourceVersion, err)
+				select {
+				case <-time.After(backoff.Step()):
+				case <-ctx.Done():
+					return
+				}
+			}
+			w, err = c.Watch(ctx, namespace, opts)
+			if err == nil {
+				break
+			}
+			delay = true
+		}
+	}
+}
+
+// forward sends the events of w until it is closed, recording their resourceVersion in opts. It returns whether events
+// were received, and the error of the watch if it failed.
+func (r *resumableWatcher) forward(ctx context.Context, w watch.Interface, opts *metav1.ListOptions) (bool, error) {
+	received := false
+	for {
+		select {
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return received, nil
+			}
+			if event.Type == watch.Error {
+				return received, apierrors.FromObject(event.Object)
+			}
+			received = true
+			if m, err := meta.Accessor(event.Object); err == nil && m.GetResourceVersion() != "" {
+				opts.ResourceVersion = m.GetResourceVersion()
+			}
+			if !r.send(ctx, event) {
+				return received, nil
+			}
+		case <-ctx.Done():
+			return received, nil
+		}
+	}
+}
+
+func (r *resumableWatcher) send(ctx context.Context, event watch.Event) bool {
+	select {
+	case r.eventChan <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func isHistoryExpired(err error) bool {
+	return apierrors.IsResourceExpired(err) || apierrors.IsGone(err)
+}
+
+func historyExpiredEvent(err error) watch.Event {
+	var apiStatus apierrors.APIStatus
+	status := &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Message: err.Error(),
+	}
+	if errors.As(err, &apiStatus) {
+		s := apiStatus.Status()
+		status = &s
+	}
+	return watch.Event{
+		Type:   HistoryExpired,
+		Object: status,
+	}
+}
+
+func newResumableWatchBackoff() *wait.Backoff {
+	return &wait.Backoff{
+		Duration: resumableWatchInitialBackoff,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    math.MaxInt,
+		Cap:      resumableWatchMaxBackoff,
+	}
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/rest/fake"
+)
+
+// newWatchClient returns a client whose successive watches return the given bodies
+func newWatchClient(bodies ...string) (*Client, *[]string) {
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	mockRESTClient := &fake.RESTClient{
+		GroupVersion:         gvr.GroupVersion(),
+		NegotiatedSerializer: negotiatedSerializer.WithoutConversion(),
+	}
+	var queries []string
+	mockRESTClient.Client = fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+		queries = append(queries, req.URL.RawQuery)
+		body := bodies[0]
+		bodies = bodies[1:]
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{runtime.ContentTypeJSON}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+	return NewClient(gvr, "Pod", true, mockRESTClient, 0), &queries
+}
+
+func watchEventTypes(t *testing.T, w watch.Interface) []watch.EventType {
+	var types []watch.EventType
+	for event := range w.ResultChan() {
+		types = append(types, event.Type)
+		if event.Type == HistoryExpired {
+			assert.Equal(t, metav1.StatusReasonExpired, event.Object.(*metav1.Status).Reason)
+		}
+	}
+	return types
+}
+
+func TestClient_WatchResumable(t *testing.T) {
+	t.Parallel()
+
+	// the first watch is closed after two events, the resumed one fails as its resourceVersion expired
+	c, queries := newWatchClient(
+		`{"type":"ADDED","object":{"apiVersion":"v1","kind":"Pod","metadata":{"name":"foo","resourceVersion":"1"}}}
+{"type":"BOOKMARK","object":{"apiVersion":"v1","kind":"Pod","metadata":{"resourceVersion":"2"}}}`,
+		`{"type":"ERROR","object":{"apiVersion":"v1","kind":"Status","status":"Failure","reason":"Expired","code":410}}`,
+	)
+
+	w, err := c.WatchResumable(context.TODO(), "bar", metav1.ListOptions{})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	assert.Equal(t, []watch.EventType{watch.Added, watch.Bookmark, HistoryExpired}, watchEventTypes(t, w))
+	require.Len(t, *queries, 2)
+	assert.Contains(t, (*queries)[0], "allowWatchBookmarks=true")
+	assert.Contains(t, (*queries)[1], "resourceVersion=2")
+}
+
+func TestClient_WatchResumable_noResourceVersion(t *testing.T) {
+	t.Parallel()
+
+	// the watch is closed before its first event, leaving no resourceVersion to resume from
+	c, queries := newWatchClient(``)
+
+	w, err := c.WatchResumable(context.TODO(), "bar", metav1.ListOptions{})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	assert.Equal(t, []watch.EventType{HistoryExpired}, watchEventTypes(t, w))
+	assert.Len(t, *queries, 1, "the watch is not resumed from now")
+}
+
+func TestClient_Watch_ContextCanceled(t *testing.T) {
+	t.Parallel()
+
+	client := &Client{kind: "testkind"}
+	mockWatcher := watch.NewRaceFreeFake()
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err := client.injectKind(ctx, mockWatcher, nil)
+	require.NoError(t, err)
+
+	// the event is never consumed, canceling ctx must still end the watch
+	mockWatcher.Add(&v1.Pod{})
+	cancel()
+	for range w.ResultChan() {
+	}
+	assert.True(t, mockWatcher.IsStopped())
+}
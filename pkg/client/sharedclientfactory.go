@@ -12,7 +12,6 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/rest"
 )
@@ -20,6 +19,25 @@ import (
 type SharedClientFactoryOptions struct {
 	Mapper meta.RESTMapper
 	Scheme *runtime.Scheme
+	// FieldManager is the default field manager of the server-side apply requests of the clients
+	FieldManager string
+	// Interceptors wrap the requests of every client, the first interceptor being the outermost
+	Interceptors []Interceptor
+	// DryRun turns every write of the clients into a dry-run write, logged with a diff, see DryRunInterceptor
+	DryRun bool
+	// DryRunCurrentObject returns the current objects the dry-run writes are compared to, such as
+	// cache.CachedObjectFunc. It defaults to getting them from the API server.
+	DryRunCurrentObject CurrentObjectFunc
+	// Protobuf sends and receives the built-in types of Kubernetes as protobuf instead of JSON, which is much cheaper
+	// to decode. CRDs and Unstructured objects keep using JSON.
+	Protobuf bool
+	// CBOR accepts CBOR responses for the requests not using protobuf, from the API servers supporting it. Request
+	// bodies are still sent as JSON. It requires the ClientsAllowCBOR feature gate of client-go, enabled by setting
+	// KUBE_FEATURE_ClientsAllowCBOR=true, without which JSON is used.
+	CBOR bool
+	// RateLimits are client-side token buckets per resource or per group, waited on before the rate limiter of the
+	// REST client shared by every client. A resource uses its own RateLimit if any, else the one of its group.
+	RateLimits []RateLimit
 }
 
 type SharedClientFactory interface {
@@ -41,6 +59,19 @@ type sharedClientFactory struct {
 	timeout    time.Duration
 	rest       rest.Interface
 	config     *rest.Config
+	// protobuf is the RESTClient of the built-in types, nil unless protobuf is enabled
+	protobuf rest.Interface
+	// reservedConfig, reservedRest and reservedProtobuf are the unlimited counterparts of config, rest and protobuf,
+	// used by the clients of reserved rate limits
+	reservedConfig   *rest.Config
+	reservedRest     rest.Interface
+	reservedProtobuf rest.Interface
+	rateLimits       []*rateLimit
+	// fieldManager is the default field manager of the clients
+	fieldManager string
+	interceptors []Interceptor
+	dryRun       bool
+	dryRunObject CurrentObjectFunc
 
 	Mapper meta.RESTMapper
 	Scheme *runtime.Scheme
@@ -56,26 +87,66 @@ func NewSharedClientFactory(config *rest.Config, opts *SharedClientFactoryOption
 		return nil, err
 	}
 
-	config, timeout := populateConfig(opts.Scheme, config)
-	rest, err := rest.UnversionedRESTClientFor(config)
+	config, timeout := populateConfig(opts.Scheme, config, opts.CBOR)
+	discovery, err := discovery.NewDiscoveryClientForConfig(config)
 	if err != nil {
 		return nil, err
 	}
 
-	discovery, err := discovery.NewDiscoveryClientForConfig(config)
+	rateLimits, err := newRateLimits(opts.RateLimits)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.CBOR {
+		config = withCBOR(config)
+	}
+	rest, protobuf, err := restClientsFor(config, opts.Protobuf)
 	if err != nil {
 		return nil, err
 	}
 
-	return &sharedClientFactory{
-		timeout:   timeout,
-		clients:   map[schema.GroupVersionResource]*Client{},
-		Scheme:    opts.Scheme,
-		Mapper:    opts.Mapper,
-		rest:      rest,
-		config:    config,
-		discovery: discovery,
-	}, nil
+	s := &sharedClientFactory{
+		timeout:    timeout,
+		clients:    map[schema.GroupVersionResource]*Client{},
+		Scheme:     opts.Scheme,
+		Mapper:     opts.Mapper,
+		rest:       rest,
+		config:     config,
+		protobuf:   protobuf,
+		rateLimits: rateLimits,
+		discovery:  discovery,
+
+		fieldManager: opts.FieldManager,
+		interceptors: opts.Interceptors,
+		dryRun:       opts.DryRun,
+		dryRunObject: opts.DryRunCurrentObject,
+	}
+
+	if hasReservedRateLimit(rateLimits) {
+		s.reservedConfig = unlimitedConfig(config)
+		s.reservedRest, s.reservedProtobuf, err = restClientsFor(s.reservedConfig, opts.Protobuf)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// restClientsFor returns the RESTClient of config, and its protobuf counterpart if protobuf is set
+func restClientsFor(config *rest.Config, protobuf bool) (restClient, protobufClient rest.Interface, err error) {
+	restClient, err = rest.UnversionedRESTClientFor(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	if protobuf {
+		protobufClient, err = protobufRESTClientFor(*config)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return restClient, protobufClient, nil
 }
 
 func applyDefaults(config *rest.Config, opts *SharedClientFactoryOptions) (*SharedClientFactoryOptions, error) {
@@ -189,9 +260,30 @@ func (s *sharedClientFactory) ForResourceKind(gvr schema.GroupVersionResource, k
 		return client
 	}
 
-	client = NewClient(gvr, kind, namespaced, s.rest, s.timeout)
-	if s.config != nil {
-		client.Config = *s.config
+	restClient, protobuf, config := s.rest, s.protobuf, s.config
+	limit := rateLimitFor(s.rateLimits, gvr.GroupResource())
+	if limit != nil && limit.Reserved {
+		restClient, protobuf, config = s.reservedRest, s.reservedProtobuf, s.reservedConfig
+	}
+
+	client = NewClient(gvr, kind, namespaced, restClient, s.timeout)
+	if config != nil {
+		client.Config = *config
+	}
+	if protobuf != nil && supportsProtobuf(s.Scheme, gvr.GroupVersion().WithKind(kind)) {
+		client.protobuf = protobuf
+	}
+	client.fieldManager = s.fieldManager
+	client.interceptors = s.interceptors
+	if s.dryRun {
+		current := s.dryRunObject
+		if current == nil {
+			current = liveObjectFunc(client)
+		}
+		client.dryRun = DryRunInterceptor(current)
+	}
+	if limit != nil {
+		client.rateLimit = RateLimitInterceptor(limit.limiter)
 	}
 	s.clients[gvr] = client
 	return client
@@ -203,10 +295,10 @@ func (s *sharedClientFactory) getClient(gvr schema.GroupVersionResource) *Client
 	return s.clients[gvr]
 }
 
-func populateConfig(scheme *runtime.Scheme, config *rest.Config) (*rest.Config, time.Duration) {
+func populateConfig(scheme *runtime.Scheme, config *rest.Config, acceptCBOR bool) (*rest.Config, time.Duration) {
 	config = rest.CopyConfig(config)
 	config.NegotiatedSerializer = unstructuredNegotiator{
-		NegotiatedSerializer: serializer.NewCodecFactory(scheme).WithoutConversion(),
+		NegotiatedSerializer: codecFactory(scheme, acceptCBOR).WithoutConversion(),
 	}
 	if config.UserAgent == "" {
 		config.UserAgent = rest.DefaultKubernetesUserAgent()
@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/url"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// parentSubresources are the subresources whose requests and responses are objects of the kind of the client
+var parentSubresources = map[string]bool{
+	"status":              true,
+	"approval":            true,
+	"ephemeralcontainers": true,
+	"finalize":            true,
+	"resize":              true,
+}
+
+// GetSubresource will attempt to get the given subresource of the resource with the given name in the given namespace (if client.Namespaced is set to true),
+// such as "scale", and unmarshal the response into the provided result object.
+// The kind of the client is only set on results of subresources returning the resource itself, such as "status".
+func (c *Client) GetSubresource(ctx context.Context, namespace, name, subresource string, result runtime.Object, opts metav1.GetOptions) (err error) {
+	return c.invoke(ctx, &Request{
+		Verb:        VerbGet,
+		Namespace:   namespace,
+		Name:        name,
+		Subresource: subresource,
+		Options:     &opts,
+		Result:      result,
+	}, func(ctx context.Context, _ *Request) (err error) {
+		defer c.setSubresourceKind(subresource, result)
+		ctx, cancel := c.setupCtx(ctx)
+		defer cancel()
+		err = c.restClient(result).Get().
+			Prefix(c.prefix...).
+			NamespaceIfScoped(namespace, c.Namespaced).
+			Resource(c.resource).
+			Name(name).
+			SubResource(subresource).
+			VersionedParams(&opts, metav1.ParameterCodec).
+			Do(ctx).
+			Into(result)
+		return
+	})
+}
+
+// CreateSubresource will attempt to post obj to the given subresource of the resource with the given name in the given namespace (if client.Namespaced is set to true),
+// such as an Eviction to "eviction" or a TokenRequest to "token", and unmarshal the response into the provided result object.
+func (c *Client) CreateSubresource(ctx context.Context, namespace, name, subresource string, obj, result runtime.Object, opts metav1.CreateOptions) (err error) {
+	return c.invoke(ctx, &Request{
+		Verb:        VerbCreate,
+		Namespace:   namespace,
+		Name:        name,
+		Subresource: subresource,
+		Options:     &opts,
+		Body:        obj,
+		Result:      result,
+	}, func(ctx context.Context, _ *Request) (err error) {
+		defer c.setSubresourceKind(subresource, result)
+		ctx, cancel := c.setupCtx(ctx)
+		defer cancel()
+		err = c.restClient(obj, result).Post().
+			Prefix(c.prefix...).
+			NamespaceIfScoped(namespace, c.Namespaced).
+			Resource(c.resource).
+			Name(name).
+			SubResource(subresource).
+			VersionedParams(&opts, metav1.ParameterCodec).
+			Body(obj).
+			Do(ctx).
+			Into(result)
+		return
+	})
+}
+
+// UpdateSubresource will attempt to put obj to the given subresource of the resource with the given name in the given namespace (if client.Namespaced is set to true),
+// such as a Scale to "scale", and unmarshal the response into the provided result object.
+// Like UpdateStatus, updates of subresources returning the resource itself wait for the WriteWaiter of the client.
+func (c *Client) UpdateSubresource(ctx context.Context, namespace, name, subresource string, obj, result runtime.Object, opts metav1.UpdateOptions) (err error) {
+	err = c.invoke(ctx, &Request{
+		Verb:        VerbUpdate,
+		Namespace:   namespace,
+		Name:        name,
+		Subresource: subresource,
+		Options:     &opts,
+		Body:        obj,
+		Result:      result,
+	}, func(ctx context.Context, _ *Request) (err error) {
+		defer c.setSubresourceKind(subresource, result)
+		ctx, cancel := c.setupCtx(ctx)
+		defer cancel()
+		err = c.restClient(obj, result).Put().
+			Prefix(c.prefix...).
+			NamespaceIfScoped(namespace, c.Namespaced).
+			Resource(c.resource).
+			Name(name).
+			SubResource(subresource).
+			VersionedParams(&opts, metav1.ParameterCodec).
+			Body(obj).
+			Do(ctx).
+			Into(result)
+		return
+	})
+	if err != nil || !parentSubresources[subresource] {
+		return err
+	}
+	return c.waitForWrite(ctx, result, opts.DryRun)
+}
+
+// StreamSubresource will attempt to stream the given subresource of the resource with the given name in the given namespace (if client.Namespaced is set to true),
+// such as "log", with the given query parameters. The default timeout of the client does not apply, as streams such as
+// followed logs are long-lived: the stream lasts until it is closed or ctx is done.
+func (c *Client) StreamSubresource(ctx context.Context, namespace, name, subresource string, params url.Values) (io.ReadCloser, error) {
+	req := &Request{
+		Verb:        VerbGet,
+		Namespace:   namespace,
+		Name:        name,
+		Subresource: subresource,
+		Options:     params,
+	}
+	err := c.invoke(ctx, req, func(ctx context.Context, req *Request) (err error) {
+		r := c.RESTClient.Get().
+			Prefix(c.prefix...).
+			NamespaceIfScoped(namespace, c.Namespaced).
+			Resource(c.resource).
+			Name(name).
+			SubResource(subresource)
+		for key, values := range params {
+			for _, value := range values {
+				r = r.Param(key, value)
+			}
+		}
+		req.Stream, err = r.Stream(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return req.Stream, nil
+}
+
+func (c *Client) setSubresourceKind(subresource string, obj runtime.Object) {
+	if parentSubresources[subresource] {
+		c.setKind(obj)
+	}
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/rest/fake"
+)
+
+func TestClient_Subresources(t *testing.T) {
+	t.Parallel()
+
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	mockRESTClient := &fake.RESTClient{
+		GroupVersion:         gvr.GroupVersion(),
+		NegotiatedSerializer: negotiatedSerializer,
+	}
+	var requests []string
+	mockRESTClient.Client = fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+		requests = append(requests, req.Method+" "+req.URL.Path+"?"+req.URL.RawQuery)
+		var body []byte
+		if req.URL.Path == "/api/v1/namespaces/bar/pods/foo/log" {
+			body = []byte("line 1\nline 2\n")
+		} else {
+			var err error
+			body, err = json.Marshal(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "bar"}})
+			if err != nil {
+				return nil, err
+			}
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{runtime.ContentTypeJSON}},
+			Body:       io.NopCloser(bytes.NewReader(body)),
+		}, nil
+	})
+	c := NewClient(gvr, "Pod", true, mockRESTClient, 0)
+
+	pod := &v1.Pod{}
+	require.NoError(t, c.GetSubresource(context.TODO(), "bar", "foo", "status", pod, metav1.GetOptions{}))
+	assert.Equal(t, "Pod", pod.Kind, "the status subresource returns the pod itself")
+
+	binding := &v1.Binding{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "bar"}, Target: v1.ObjectReference{Name: "node"}}
+	result := &v1.Pod{}
+	require.NoError(t, c.CreateSubresource(context.TODO(), "bar", "foo", "binding", binding, result, metav1.CreateOptions{}))
+	assert.Empty(t, result.Kind)
+
+	require.NoError(t, c.UpdateSubresource(context.TODO(), "bar", "foo", "ephemeralcontainers", pod, &v1.Pod{}, metav1.UpdateOptions{DryRun: []string{metav1.DryRunAll}}))
+
+	stream, err := c.StreamSubresource(context.TODO(), "bar", "foo", "log", url.Values{"follow": []string{"true"}})
+	require.NoError(t, err)
+	logs, err := io.ReadAll(stream)
+	require.NoError(t, err)
+	require.NoError(t, stream.Close())
+	assert.Equal(t, "line 1\nline 2\n", string(logs))
+
+	assert.Equal(t, []string{
+		"GET /api/v1/namespaces/bar/pods/foo/status?",
+		"POST /api/v1/namespaces/bar/pods/foo/binding?",
+		"PUT /api/v1/namespaces/bar/pods/foo/ephemeralcontainers?dryRun=All",
+		"GET /api/v1/namespaces/bar/pods/foo/log?follow=true",
+	}, requests)
+}
+
+func TestClient_StreamSubresource_outlivesTimeout(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("line 1\n"))
+		w.(http.Flusher).Flush()
+		time.Sleep(100 * time.Millisecond)
+		_, _ = w.Write([]byte("line 2\n"))
+	}))
+	t.Cleanup(server.Close)
+
+	f, err := NewSharedClientFactory(&rest.Config{Host: server.URL, Timeout: 10 * time.Millisecond}, &SharedClientFactoryOptions{
+		Mapper: meta.NewDefaultRESTMapper(nil),
+		Scheme: testSchema,
+	})
+	require.NoError(t, err)
+	pods := f.ForResourceKind(v1.SchemeGroupVersion.WithResource("pods"), "Pod", true)
+
+	stream, err := pods.StreamSubresource(context.TODO(), "bar", "foo", "log", url.Values{"follow": []string{"true"}})
+	require.NoError(t, err)
+	defer stream.Close()
+	logs, err := io.ReadAll(stream)
+	require.NoError(t, err, "the default timeout of the client does not apply to streams")
+	assert.Equal(t, "line 1\nline 2\n", string(logs))
+}
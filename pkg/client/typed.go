@@ -0,0 +1,205 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// TypedClient wraps a Client, allocating the results of its requests. T and TList must be pointers to structs, such as
+// *corev1.Pod and *corev1.PodList, or *unstructured.Unstructured and *unstructured.UnstructuredList.
+type TypedClient[T runtime.Object, TList runtime.Object] struct {
+	Client *Client
+}
+
+// NewTypedClient returns a TypedClient sending its requests with client, made unstructured if T is Unstructured
+func NewTypedClient[T runtime.Object, TList runtime.Object](client *Client) *TypedClient[T, TList] {
+	if _, ok := any(newTyped[T]()).(runtime.Unstructured); ok {
+		client = client.WithUnstructured()
+	}
+	return &TypedClient[T, TList]{
+		Client: client,
+	}
+}
+
+// NewTypedClientForFactory returns a TypedClient for the kind registered for T in the scheme of factory. Unstructured
+// objects have no kind registered, use NewTypedClient with the client of the desired kind instead.
+func NewTypedClientForFactory[T runtime.Object, TList runtime.Object](factory SharedClientFactory) (*TypedClient[T, TList], error) {
+	gvk, err := factory.GVKForObject(newTyped[T]())
+	if err != nil {
+		return nil, err
+	}
+	client, err := factory.ForKind(gvk)
+	if err != nil {
+		return nil, err
+	}
+	return NewTypedClient[T, TList](client), nil
+}
+
+// Get returns the object with the given name in the given namespace
+func (t *TypedClient[T, TList]) Get(ctx context.Context, namespace, name string, opts metav1.GetOptions) (T, error) {
+	result := newTyped[T]()
+	if err := t.Client.Get(ctx, namespace, name, result, opts); err != nil {
+		var zero T
+		return zero, err
+	}
+	return result, nil
+}
+
+// List returns the objects of the given namespace, or of all namespaces if namespace is empty
+func (t *TypedClient[T, TList]) List(ctx context.Context, namespace string, opts metav1.ListOptions) ([]T, error) {
+	list := newTyped[TList]()
+	if err := t.Client.List(ctx, namespace, list, opts); err != nil {
+		return nil, err
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]T, 0, len(items))
+	for _, item := range items {
+		obj, ok := item.(T)
+		if !ok {
+			return nil, fmt.Errorf("unexpected item of type %T in %T", item, list)
+		}
+		result = append(result, obj)
+	}
+	return result, nil
+}
+
+// Create creates obj in the given namespace and returns the created object
+func (t *TypedClient[T, TList]) Create(ctx context.Context, namespace string, obj T, opts metav1.CreateOptions) (T, error) {
+	return t.do(func(result T) error {
+		return t.Client.Create(ctx, namespace, obj, result, opts)
+	})
+}
+
+// Update updates obj in the given namespace and returns the updated object
+func (t *TypedClient[T, TList]) Update(ctx context.Context, namespace string, obj T, opts metav1.UpdateOptions) (T, error) {
+	return t.do(func(result T) error {
+		return t.Client.Update(ctx, namespace, obj, result, opts)
+	})
+}
+
+// UpdateStatus updates the status of obj in the given namespace and returns the updated object
+func (t *TypedClient[T, TList]) UpdateStatus(ctx context.Context, namespace string, obj T, opts metav1.UpdateOptions) (T, error) {
+	return t.do(func(result T) error {
+		return t.Client.UpdateStatus(ctx, namespace, obj, result, opts)
+	})
+}
+
+// Patch patches the object with the given name in the given namespace and returns the patched object
+func (t *TypedClient[T, TList]) Patch(ctx context.Context, namespace, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (T, error) {
+	return t.do(func(result T) error {
+		return t.Client.Patch(ctx, namespace, name, pt, data, result, opts, subresources...)
+	})
+}
+
+// Apply sends obj as a server-side apply patch in the given namespace and returns the resulting object
+func (t *TypedClient[T, TList]) Apply(ctx context.Context, namespace string, obj T, opts ApplyOptions) (T, error) {
+	return t.do(func(result T) error {
+		return t.Client.Apply(ctx, namespace, obj, result, opts)
+	})
+}
+
+// ApplyStatus sends obj as a server-side apply patch of the status subresource and returns the resulting object
+func (t *TypedClient[T, TList]) ApplyStatus(ctx context.Context, namespace string, obj T, opts ApplyOptions) (T, error) {
+	return t.do(func(result T) error {
+		return t.Client.ApplyStatus(ctx, namespace, obj, result, opts)
+	})
+}
+
+// Delete deletes the object with the given name in the given namespace
+func (t *TypedClient[T, TList]) Delete(ctx context.Context, namespace, name string, opts metav1.DeleteOptions) error {
+	return t.Client.Delete(ctx, namespace, name, opts)
+}
+
+// Watch starts a watch of the objects in the given namespace, or of all namespaces if namespace is empty
+func (t *TypedClient[T, TList]) Watch(ctx context.Context, namespace string, opts metav1.ListOptions) (TypedWatch[T], error) {
+	w, err := t.Client.Watch(ctx, namespace, opts)
+	if err != nil {
+		return nil, err
+	}
+	return newTypedWatcher[T](w), nil
+}
+
+func newTypedWatcher[T runtime.Object](w watch.Interface) TypedWatch[T] {
+	eventChan := make(chan TypedEvent[T])
+	go func() {
+		defer close(eventChan)
+		for event := range w.ResultChan() {
+			typed := TypedEvent[T]{
+				Type: event.Type,
+			}
+			switch obj := event.Object.(type) {
+			case T:
+				typed.Object = obj
+			case *metav1.Status:
+				typed.Status = obj
+			default:
+				var want T
+				typed.Type = watch.Error
+				typed.Status = &apierrors.NewInternalError(fmt.Errorf("watch event of type %s has a %T instead of %T", event.Type, event.Object, want)).ErrStatus
+			}
+			eventChan <- typed
+		}
+	}()
+
+	return &typedWatcher[T]{
+		wrapped:   w,
+		eventChan: eventChan,
+	}
+}
+
+func (t *TypedClient[T, TList]) do(request func(result T) error) (T, error) {
+	result := newTyped[T]()
+	if err := request(result); err != nil {
+		var zero T
+		return zero, err
+	}
+	return result, nil
+}
+
+// TypedEvent is a watch event of a TypedClient. Object is set for Added, Modified, Deleted and Bookmark events, and
+// Status for Error events.
+type TypedEvent[T runtime.Object] struct {
+	Type   watch.EventType
+	Object T
+	Status *metav1.Status
+}
+
+// TypedWatch is the watch.Interface of a TypedClient
+type TypedWatch[T runtime.Object] interface {
+	Stop()
+	ResultChan() <-chan TypedEvent[T]
+}
+
+type typedWatcher[T runtime.Object] struct {
+	wrapped   watch.Interface
+	eventChan chan TypedEvent[T]
+}
+
+func (w *typedWatcher[T]) Stop() {
+	w.wrapped.Stop()
+	// Drain eventChan until the processing goroutine closes it, propagated from the original ResultChan
+	for range w.eventChan {
+	}
+}
+
+// ResultChan returns a receive only channel of typed watch events.
+func (w *typedWatcher[T]) ResultChan() <-chan TypedEvent[T] {
+	return w.eventChan
+}
+
+// newTyped allocates the struct T points to
+func newTyped[T runtime.Object]() T {
+	var zero T
+	return reflect.New(reflect.TypeOf(zero).Elem()).Interface().(T)
+}
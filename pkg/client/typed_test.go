@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/rest/fake"
+)
+
+func TestTypedClient(t *testing.T) {
+	t.Parallel()
+
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	pod := &v1.Pod{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "bar"},
+	}
+	mockRESTClient := &fake.RESTClient{
+		GroupVersion:         gvr.GroupVersion(),
+		NegotiatedSerializer: negotiatedSerializer,
+	}
+	c := NewClient(gvr, "Pod", true, mockRESTClient, 0)
+	typed := NewTypedClient[*v1.Pod, *v1.PodList](c)
+
+	mockRESTClient.Client = fake.CreateHTTPClient(newRequestHandler(c, pod, "bar", false, false))
+	got, err := typed.Get(context.TODO(), "bar", "foo", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, pod, got)
+
+	got, err = typed.Create(context.TODO(), "bar", pod, metav1.CreateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, pod, got)
+
+	list := &v1.PodList{Items: []v1.Pod{*pod, *pod}}
+	mockRESTClient.Client = fake.CreateHTTPClient(newRequestHandler(c, list, "bar", true, false))
+	items, err := typed.List(context.TODO(), "bar", metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, "foo", items[1].Name)
+}
+
+func TestTypedClient_Watch(t *testing.T) {
+	t.Parallel()
+
+	fakeWatcher := watch.NewFake()
+	w := newTypedWatcher[*v1.Pod](fakeWatcher)
+
+	go func() {
+		fakeWatcher.Add(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "foo"}})
+		fakeWatcher.Error(&metav1.Status{Code: 410})
+		fakeWatcher.Modify(&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "foo"}})
+	}()
+
+	event := <-w.ResultChan()
+	assert.Equal(t, watch.Added, event.Type)
+	assert.Equal(t, "foo", event.Object.Name)
+
+	event = <-w.ResultChan()
+	assert.Equal(t, watch.Error, event.Type)
+	assert.Nil(t, event.Object)
+	assert.Equal(t, int32(410), event.Status.Code)
+
+	event = <-w.ResultChan()
+	assert.Equal(t, watch.Error, event.Type, "objects of another type are reported as errors")
+	assert.Nil(t, event.Object)
+	assert.Equal(t, metav1.StatusReasonInternalError, event.Status.Reason)
+	assert.Contains(t, event.Status.Message, "*v1.Secret")
+
+	w.Stop()
+	_, ok := <-w.ResultChan()
+	assert.False(t, ok)
+}
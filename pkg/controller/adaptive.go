@@ -0,0 +1,233 @@
+package controller
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rancher/lasso/pkg/metrics"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	defaultAdaptiveInitialLimit     = 10
+	defaultAdaptiveBackoff          = 0.5
+	defaultAdaptiveDecreaseCooldown = time.Second
+)
+
+type AdaptiveConcurrencyOptions struct {
+	// MinLimit is the lowest concurrency a controller is shrunk to, defaults to 1
+	MinLimit int
+	// MaxLimit caps the concurrency a controller grows to, on top of its number of workers. Zero means no cap.
+	MaxLimit int
+	// InitialLimit is the concurrency every controller starts with, defaults to MaxLimit if set, 10 otherwise
+	InitialLimit int
+	// Backoff is the factor applied to the limit when the API server is overloaded, defaults to 0.5
+	Backoff float64
+	// DecreaseCooldown is the minimum time between two decreases of the limit, so a single burst of throttled
+	// requests only shrinks it once. Defaults to 1s.
+	DecreaseCooldown time.Duration
+	// ReconcileLatencyThreshold, if set, treats reconciles slower than the threshold as an overload signal
+	ReconcileLatencyThreshold time.Duration
+	// ClientLatencyThreshold, if set, treats API requests slower than the threshold as an overload signal
+	ClientLatencyThreshold time.Duration
+}
+
+// AdaptiveConcurrency creates ConcurrencyLimiters whose limit follows an AIMD (additive increase, multiplicative
+// decrease) scheme: it shrinks when the API server throttles requests or becomes slow and grows back while healthy.
+//
+// Signals come from the reconcile errors and durations of every controller, and from the API responses observed by
+// WrapTransport. The latter cannot be attributed to a controller: every request going through the wrapped transport
+// counts, including the lists and watches of the caches and the requests made outside of reconciles, and each signal
+// is fed to every controller with keys in flight.
+type AdaptiveConcurrency struct {
+	opts AdaptiveConcurrencyOptions
+	// transportWrapped is set once WrapTransport was called
+	transportWrapped atomic.Bool
+
+	lock     sync.RWMutex
+	limiters []*adaptiveLimiter
+}
+
+func NewAdaptiveConcurrency(opts AdaptiveConcurrencyOptions) *AdaptiveConcurrency {
+	if opts.MinLimit <= 0 {
+		opts.MinLimit = 1
+	}
+	if opts.InitialLimit == 0 {
+		opts.InitialLimit = defaultAdaptiveInitialLimit
+		if opts.MaxLimit > 0 {
+			opts.InitialLimit = opts.MaxLimit
+		}
+	}
+	if opts.InitialLimit < opts.MinLimit {
+		opts.InitialLimit = opts.MinLimit
+	}
+	if opts.Backoff <= 0 || opts.Backoff >= 1 {
+		opts.Backoff = defaultAdaptiveBackoff
+	}
+	if opts.DecreaseCooldown == 0 {
+		opts.DecreaseCooldown = defaultAdaptiveDecreaseCooldown
+	}
+	return &AdaptiveConcurrency{
+		opts: opts,
+	}
+}
+
+// ForController returns the ConcurrencyLimiter to be used by the named controller
+func (a *AdaptiveConcurrency) ForController(name string) ConcurrencyLimiter {
+	l := &adaptiveLimiter{
+		opts:     a.opts,
+		name:     name,
+		limit:    float64(a.opts.InitialLimit),
+		released: make(chan struct{}),
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.limiters = append(a.limiters, l)
+	return l
+}
+
+// WrapTransport observes the API responses going through the given RoundTripper. It can be used with
+// rest.Config.Wrap, so throttled requests shrink the concurrency of the controllers. It is only set up automatically
+// by NewSharedControllerFactoryFromConfigWithOptions: factories created from an existing cache factory need it on the
+// config of their client factory.
+func (a *AdaptiveConcurrency) WrapTransport(rt http.RoundTripper) http.RoundTripper {
+	a.transportWrapped.Store(true)
+	return &adaptiveTransport{
+		parent:  a,
+		wrapped: rt,
+	}
+}
+
+func (a *AdaptiveConcurrency) overloaded() {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	for _, l := range a.limiters {
+		l.overloaded()
+	}
+}
+
+type adaptiveTransport struct {
+	parent  *AdaptiveConcurrency
+	wrapped http.RoundTripper
+}
+
+func (t *adaptiveTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.wrapped.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	// both client-side and Priority and Fairness rejections result in a 429
+	if resp.StatusCode == http.StatusTooManyRequests {
+		t.parent.overloaded()
+	} else if threshold := t.parent.opts.ClientLatencyThreshold; threshold > 0 && req.URL.Query().Get("watch") != "true" && time.Since(start) > threshold {
+		t.parent.overloaded()
+	}
+	return resp, err
+}
+
+type adaptiveLimiter struct {
+	opts AdaptiveConcurrencyOptions
+	name string
+
+	lock         sync.Mutex
+	ctxID        string
+	limit        float64
+	inFlight     int
+	lastDecrease time.Time
+	released     chan struct{}
+}
+
+func (l *adaptiveLimiter) Acquire(ctx context.Context) (func(error), error) {
+	for {
+		l.lock.Lock()
+		if l.ctxID == "" {
+			l.ctxID = metrics.ContextID(ctx)
+			metrics.SetAdaptiveConcurrencyLimit(l.ctxID, l.name, int(l.limit))
+		}
+		if l.inFlight < int(l.limit) {
+			l.inFlight++
+			l.lock.Unlock()
+
+			start := time.Now()
+			return func(err error) {
+				l.release(err, start)
+			}, nil
+		}
+		released := l.released
+		l.lock.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (l *adaptiveLimiter) release(err error, start time.Time) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	saturated := l.inFlight >= int(l.limit)
+	l.inFlight--
+
+	latency := time.Since(start)
+	if isOverloadError(err) || (l.opts.ReconcileLatencyThreshold > 0 && latency > l.opts.ReconcileLatencyThreshold) {
+		l.decrease()
+	} else if saturated && start.After(l.lastDecrease) {
+		// only grow while the whole limit is in use, otherwise the limit would grow unbounded on idle controllers.
+		// Reconciles started before the last decrease do not count, as they ran under the previous limit.
+		l.increase()
+	}
+
+	close(l.released)
+	l.released = make(chan struct{})
+}
+
+// overloaded reacts to a signal that is not tied to a specific reconcile, ignoring it if no key is being reconciled
+func (l *adaptiveLimiter) overloaded() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.inFlight > 0 {
+		l.decrease()
+	}
+}
+
+// increase and decrease must be called while holding the lock
+func (l *adaptiveLimiter) increase() {
+	limit := l.limit + 1/l.limit
+	if l.opts.MaxLimit > 0 {
+		limit = math.Min(limit, float64(l.opts.MaxLimit))
+	}
+	l.setLimit(limit)
+}
+
+func (l *adaptiveLimiter) decrease() {
+	now := time.Now()
+	if now.Sub(l.lastDecrease) < l.opts.DecreaseCooldown {
+		return
+	}
+	l.lastDecrease = now
+	l.setLimit(math.Max(float64(l.opts.MinLimit), l.limit*l.opts.Backoff))
+}
+
+func (l *adaptiveLimiter) setLimit(limit float64) {
+	previous := int(l.limit)
+	l.limit = limit
+	if int(limit) != previous {
+		metrics.SetAdaptiveConcurrencyLimit(l.ctxID, l.name, int(limit))
+	}
+}
+
+func isOverloadError(err error) bool {
+	return err != nil && (apierrors.IsTooManyRequests(err) || apierrors.IsServerTimeout(err))
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+type statusRoundTripper int
+
+func (s statusRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: int(s), Request: req}, nil
+}
+
+func TestAdaptiveConcurrency(t *testing.T) {
+	t.Parallel()
+
+	adaptive := NewAdaptiveConcurrency(AdaptiveConcurrencyOptions{
+		MinLimit:         1,
+		MaxLimit:         4,
+		DecreaseCooldown: time.Nanosecond,
+	})
+	limiter := adaptive.ForController("test").(*adaptiveLimiter)
+	ctx := context.Background()
+
+	acquireAll := func() []func(error) {
+		var releases []func(error)
+		for {
+			ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+			release, err := limiter.Acquire(ctx)
+			cancel()
+			if err != nil {
+				return releases
+			}
+			releases = append(releases, release)
+		}
+	}
+
+	releases := acquireAll()
+	require.Len(t, releases, 4, "starts at MaxLimit")
+
+	// a throttled reconcile halves the limit
+	releases[0](fmt.Errorf("handler failed: %w", apierrors.NewTooManyRequests("slow down", 1)))
+	// a throttled API response seen while keys are in flight halves it again
+	assert.False(t, adaptive.transportWrapped.Load())
+	_, err := adaptive.WrapTransport(statusRoundTripper(http.StatusTooManyRequests)).RoundTrip(&http.Request{})
+	require.NoError(t, err)
+	assert.True(t, adaptive.transportWrapped.Load())
+	for _, release := range releases[1:] {
+		release(nil)
+	}
+	releases = acquireAll()
+	assert.Len(t, releases, 1)
+	releases[0](nil)
+
+	// saturated and healthy reconciles grow the limit back, up to MaxLimit
+	for i := 0; i < 20; i++ {
+		for _, release := range acquireAll() {
+			release(nil)
+		}
+	}
+	assert.Len(t, acquireAll(), 4)
+}
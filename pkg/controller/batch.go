@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"errors"
+	"time"
+
+	"github.com/rancher/lasso/pkg/log"
+	"github.com/rancher/lasso/pkg/metrics"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// BatchItem is a key drained from the workqueue along with its cached object, which is nil if it was deleted
+type BatchItem struct {
+	Key    string
+	Object runtime.Object
+}
+
+// BatchHandler reconciles many keys at once. It returns the error of every key that failed, keys missing from the
+// result being considered successful.
+type BatchHandler interface {
+	OnChanges(items []BatchItem) map[string]error
+}
+
+type BatchHandlerFunc func(items []BatchItem) map[string]error
+
+func (b BatchHandlerFunc) OnChanges(items []BatchItem) map[string]error {
+	return b(items)
+}
+
+// BatchOptions configures how keys are drained from the workqueue when the controller handler is a BatchHandler
+type BatchOptions struct {
+	// Size is the maximum number of keys given to the handler at once. Batching is disabled unless greater than 1.
+	Size int
+	// Window is how long to wait for more keys once the first key of a batch was dequeued. Zero only batches the
+	// keys already queued, without waiting.
+	Window time.Duration
+}
+
+func (c *controller) runBatchWorker(items <-chan []any) {
+	for {
+		batch, ok := c.nextBatch(items)
+		if !ok {
+			return
+		}
+		if !c.processBatch(batch) {
+			return
+		}
+	}
+}
+
+// fetchItems feeds the batch workers with the items of the workqueue until it is shut down. Without Window, the items
+// readily queued are sent together, up to Size, else they are sent one at a time for nextBatch to wait for more.
+func (c *controller) fetchItems(items chan<- []any, stopCh <-chan struct{}) {
+	defer close(items)
+	for {
+		obj, shutdown := c.workqueue.Get()
+		if shutdown {
+			return
+		}
+		group := []any{obj}
+		// fetchItems is the only consumer of the workqueue, so Get does not block while Len is positive
+		for c.batch.Window <= 0 && len(group) < c.batch.Size && c.workqueue.Len() > 0 {
+			obj, shutdown := c.workqueue.Get()
+			if shutdown {
+				break
+			}
+			group = append(group, obj)
+		}
+		select {
+		case items <- group:
+		case <-stopCh:
+			for _, obj := range group {
+				c.workqueue.Done(obj)
+			}
+			return
+		}
+	}
+}
+
+// nextBatch blocks until items are available, then collects more items until the batch is full or the window expires
+func (c *controller) nextBatch(items <-chan []any) ([]any, bool) {
+	batch, ok := <-items
+	if !ok {
+		return nil, false
+	}
+	if c.batch.Window <= 0 {
+		return batch, true
+	}
+
+	timer := time.NewTimer(c.batch.Window)
+	defer timer.Stop()
+	for len(batch) < c.batch.Size {
+		select {
+		case group, ok := <-items:
+			if !ok {
+				return batch, true
+			}
+			batch = append(batch, group...)
+		case <-timer.C:
+			return batch, true
+		}
+	}
+	return batch, true
+}
+
+func (c *controller) processBatch(batch []any) bool {
+	queue := c.workqueue
+	release, err := c.acquire()
+	if err != nil {
+		for _, obj := range batch {
+			c.keepForRestart(queue, obj)
+			queue.Done(obj)
+		}
+		return false
+	}
+
+	keys := make([]string, 0, len(batch))
+	items := make([]BatchItem, 0, len(batch))
+	results := map[string]error{}
+	for _, obj := range batch {
+		key, ok := obj.(string)
+		if !ok {
+			c.forget(obj)
+			c.workqueue.Done(obj)
+			log.Errorf("expected string in workqueue but got %#v", obj)
+			continue
+		}
+		if !c.owns(key) {
+			c.forget(obj)
+			c.workqueue.Done(obj)
+			continue
+		}
+		keys = append(keys, key)
+
+		cached, exists, err := c.informer.GetStore().GetByKey(key)
+		if err != nil {
+			metrics.IncTotalHandlerExecutions(c.ctxID, c.name, "", true)
+			results[key] = err
+			continue
+		}
+		item := BatchItem{Key: key}
+		if exists {
+			item.Object = cached.(runtime.Object)
+		}
+		items = append(items, item)
+	}
+
+	if len(items) > 0 {
+		for key, err := range c.batchHandler.OnChanges(items) {
+			if err != nil {
+				results[key] = err
+			}
+		}
+	}
+
+	var errs []error
+	for _, key := range keys {
+		if results[key] != nil {
+			errs = append(errs, results[key])
+		}
+	}
+	release(errors.Join(errs...))
+
+	for _, key := range keys {
+		c.logSyncError(c.handleResult(key, results[key]))
+		c.workqueue.Done(key)
+	}
+	return true
+}
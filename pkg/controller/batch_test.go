@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestController_batch(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// a long base delay keeps the failed key out of the queue for the duration of the test
+	queue := workqueue.NewTypedRateLimitingQueue(workqueue.NewTypedItemExponentialFailureRateLimiter[any](time.Hour, time.Hour))
+	defer queue.ShutDown()
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+
+	ctrl := gomock.NewController(t)
+	informer := NewMockSharedIndexInformer(ctrl)
+	informer.EXPECT().GetStore().Return(store).AnyTimes()
+	handler := &SharedHandler{ControllerName: corev1.SchemeGroupVersion.WithResource("ConfigMap").String()}
+	c := &controller{
+		informer:     informer,
+		workqueue:    queue,
+		handler:      handler,
+		batchHandler: handler,
+		batch:        BatchOptions{Size: 10, Window: time.Second},
+	}
+
+	var lock sync.Mutex
+	var batches [][]BatchItem
+	handler.RegisterBatch(ctx, "test-batch", BatchHandlerFunc(func(items []BatchItem) map[string]error {
+		lock.Lock()
+		defer lock.Unlock()
+		batches = append(batches, items)
+		return map[string]error{"test-ns/cm-1": errors.New("failed")}
+	}))
+
+	for _, name := range []string{"cm-0", "cm-1", "cm-2"} {
+		require.NoError(t, store.Add(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "test-ns", Name: name}}))
+		queue.Add("test-ns/" + name)
+	}
+	// deleted objects are handed with a nil object
+	queue.Add("test-ns/cm-3")
+
+	items := make(chan []any)
+	go c.fetchItems(items, ctx.Done())
+	go c.runBatchWorker(items)
+
+	require.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(batches) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.Len(t, batches, 1)
+	require.Len(t, batches[0], 4)
+	for i, item := range batches[0] {
+		if i < 3 {
+			assert.NotNil(t, item.Object)
+		} else {
+			assert.Nil(t, item.Object)
+		}
+	}
+
+	// results are applied per key
+	assert.Eventually(t, func() bool { return queue.NumRequeues("test-ns/cm-1") == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 0, queue.NumRequeues("test-ns/cm-0"))
+	assert.Equal(t, 0, queue.NumRequeues("test-ns/cm-2"))
+}
+
+func TestController_batchWithoutWindow(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	queue := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[any]())
+	defer queue.ShutDown()
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+
+	ctrl := gomock.NewController(t)
+	informer := NewMockSharedIndexInformer(ctrl)
+	informer.EXPECT().GetStore().Return(store).AnyTimes()
+	handler := &SharedHandler{ControllerName: corev1.SchemeGroupVersion.WithResource("ConfigMap").String()}
+	c := &controller{
+		informer:     informer,
+		workqueue:    queue,
+		handler:      handler,
+		batchHandler: handler,
+		batch:        BatchOptions{Size: 100},
+	}
+
+	batches := make(chan int, 10)
+	handler.RegisterBatch(ctx, "test-batch", BatchHandlerFunc(func(items []BatchItem) map[string]error {
+		batches <- len(items)
+		return nil
+	}))
+
+	// the keys are all queued before the workers start
+	for i := 0; i < 50; i++ {
+		queue.Add(fmt.Sprintf("test-ns/cm-%d", i))
+	}
+	items := make(chan []any)
+	go c.fetchItems(items, ctx.Done())
+	go c.runBatchWorker(items)
+
+	select {
+	case size := <-batches:
+		assert.Equal(t, 50, size, "the queued keys are handled in a single batch")
+	case <-ctx.Done():
+		t.Fatal("no batch was handled")
+	}
+}
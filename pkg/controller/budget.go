@@ -0,0 +1,182 @@
+package controller
+
+import (
+	"context"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ConcurrencyLimiter caps how many keys of a controller are reconciled at once, on top of its number of workers.
+type ConcurrencyLimiter interface {
+	// Acquire blocks until a key can be reconciled or ctx is done. The returned function must be called with the
+	// result of the reconcile once it finished.
+	Acquire(ctx context.Context) (release func(err error), err error)
+}
+
+type WorkerBudgetOptions struct {
+	// MaxConcurrent caps the number of reconciles running at once across all the controllers sharing the budget. Zero
+	// or less means no cap, leaving only KindMax.
+	MaxConcurrent int
+	// KindMin guarantees a number of concurrent reconciles to a GroupVersionKind, which are reserved out of
+	// MaxConcurrent and never used by other kinds
+	KindMin map[schema.GroupVersionKind]int
+	// KindMax caps the number of concurrent reconciles of a GroupVersionKind
+	KindMax map[schema.GroupVersionKind]int
+}
+
+// WorkerBudget is a semaphore shared by many controllers, capping the total number of concurrent reconciles
+// regardless of how many workers every controller runs.
+type WorkerBudget struct {
+	lock sync.Mutex
+	// sharedCap is the part of the budget that is not reserved through KindMin, ignored if uncapped
+	sharedCap  int
+	uncapped   bool
+	sharedUsed int
+	kinds      map[schema.GroupVersionKind]*budgetKind
+	// released is closed and replaced every time a reconcile finishes, waking up every waiting worker
+	released chan struct{}
+}
+
+type budgetKind struct {
+	min   int
+	max   int
+	inUse int
+}
+
+// NewWorkerBudget creates a WorkerBudget from the given options. A MaxConcurrent lower than the sum of KindMin is
+// raised to that sum.
+func NewWorkerBudget(opts WorkerBudgetOptions) *WorkerBudget {
+	b := &WorkerBudget{
+		kinds:    map[schema.GroupVersionKind]*budgetKind{},
+		released: make(chan struct{}),
+	}
+
+	reserved := 0
+	for gvk, min := range opts.KindMin {
+		b.kind(gvk).min = min
+		reserved += min
+	}
+	for gvk, max := range opts.KindMax {
+		b.kind(gvk).max = max
+	}
+	if opts.MaxConcurrent <= 0 {
+		b.uncapped = true
+	} else if opts.MaxConcurrent > reserved {
+		b.sharedCap = opts.MaxConcurrent - reserved
+	}
+	return b
+}
+
+// ForKind returns the ConcurrencyLimiter to be used by the controller of the given GroupVersionKind
+func (b *WorkerBudget) ForKind(gvk schema.GroupVersionKind) ConcurrencyLimiter {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return &budgetLimiter{
+		budget: b,
+		kind:   b.kind(gvk),
+	}
+}
+
+func (b *WorkerBudget) kind(gvk schema.GroupVersionKind) *budgetKind {
+	k, ok := b.kinds[gvk]
+	if !ok {
+		k = &budgetKind{}
+		b.kinds[gvk] = k
+	}
+	return k
+}
+
+// tryAcquire must be called while holding the lock
+func (b *WorkerBudget) tryAcquire(k *budgetKind) bool {
+	if k.max > 0 && k.inUse >= k.max {
+		return false
+	}
+	if k.inUse < k.min {
+		k.inUse++
+		return true
+	}
+	if b.uncapped || b.sharedUsed < b.sharedCap {
+		b.sharedUsed++
+		k.inUse++
+		return true
+	}
+	return false
+}
+
+func (b *WorkerBudget) release(k *budgetKind) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if k.inUse > k.min {
+		b.sharedUsed--
+	}
+	k.inUse--
+
+	close(b.released)
+	b.released = make(chan struct{})
+}
+
+type budgetLimiter struct {
+	budget *WorkerBudget
+	kind   *budgetKind
+}
+
+func (l *budgetLimiter) Acquire(ctx context.Context) (func(error), error) {
+	for {
+		l.budget.lock.Lock()
+		if l.budget.tryAcquire(l.kind) {
+			l.budget.lock.Unlock()
+			return func(error) {
+				l.budget.release(l.kind)
+			}, nil
+		}
+		released := l.budget.released
+		l.budget.lock.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// chainLimiters returns a ConcurrencyLimiter acquiring all the given limiters in order
+func chainLimiters(limiters ...ConcurrencyLimiter) ConcurrencyLimiter {
+	var chain multiLimiter
+	for _, l := range limiters {
+		if l != nil {
+			chain = append(chain, l)
+		}
+	}
+	switch len(chain) {
+	case 0:
+		return nil
+	case 1:
+		return chain[0]
+	default:
+		return chain
+	}
+}
+
+type multiLimiter []ConcurrencyLimiter
+
+func (m multiLimiter) Acquire(ctx context.Context) (func(error), error) {
+	releases := make([]func(error), 0, len(m))
+	releaseAll := func(err error) {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i](err)
+		}
+	}
+
+	for _, l := range m {
+		release, err := l.Acquire(ctx)
+		if err != nil {
+			releaseAll(nil)
+			return nil, err
+		}
+		releases = append(releases, release)
+	}
+	return releaseAll, nil
+}
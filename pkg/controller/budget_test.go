@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestWorkerBudget(t *testing.T) {
+	t.Parallel()
+
+	secrets := schema.GroupVersionKind{Version: "v1", Kind: "Secret"}
+	leases := schema.GroupVersionKind{Group: "coordination.k8s.io", Version: "v1", Kind: "Lease"}
+	pods := schema.GroupVersionKind{Version: "v1", Kind: "Pod"}
+
+	budget := NewWorkerBudget(WorkerBudgetOptions{
+		MaxConcurrent: 3,
+		KindMin:       map[schema.GroupVersionKind]int{leases: 1},
+		KindMax:       map[schema.GroupVersionKind]int{pods: 1},
+	})
+	secretLimiter := budget.ForKind(secrets)
+	leaseLimiter := budget.ForKind(leases)
+	podLimiter := budget.ForKind(pods)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	tryAcquire := func(limiter ConcurrencyLimiter) (func(error), bool) {
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		release, err := limiter.Acquire(ctx)
+		return release, err == nil
+	}
+
+	podRelease, ok := tryAcquire(podLimiter)
+	require.True(t, ok)
+	_, ok = tryAcquire(podLimiter)
+	assert.False(t, ok, "pods are capped by KindMax")
+
+	secretRelease, ok := tryAcquire(secretLimiter)
+	require.True(t, ok)
+	_, ok = tryAcquire(secretLimiter)
+	assert.False(t, ok, "the shared part of the budget is exhausted")
+
+	leaseRelease, ok := tryAcquire(leaseLimiter)
+	require.True(t, ok, "leases have a reserved slot")
+
+	// a waiting worker is woken up as soon as a reconcile finishes
+	acquired := make(chan struct{})
+	go func() {
+		if _, err := secretLimiter.Acquire(ctx); err == nil {
+			close(acquired)
+		}
+	}()
+	podRelease(nil)
+	select {
+	case <-acquired:
+	case <-ctx.Done():
+		t.Fatal("secret reconcile never acquired the released slot")
+	}
+
+	secretRelease(nil)
+	leaseRelease(nil)
+}
+
+func TestWorkerBudget_uncapped(t *testing.T) {
+	t.Parallel()
+
+	pods := schema.GroupVersionKind{Version: "v1", Kind: "Pod"}
+	budget := NewWorkerBudget(WorkerBudgetOptions{
+		KindMax: map[schema.GroupVersionKind]int{pods: 2},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	secretLimiter := budget.ForKind(schema.GroupVersionKind{Version: "v1", Kind: "Secret"})
+	for i := 0; i < 10; i++ {
+		_, err := secretLimiter.Acquire(ctx)
+		require.NoError(t, err, "no MaxConcurrent means no cap")
+	}
+
+	podLimiter := budget.ForKind(pods)
+	for i := 0; i < 2; i++ {
+		_, err := podLimiter.Acquire(ctx)
+		require.NoError(t, err)
+	}
+	_, err := podLimiter.Acquire(ctx)
+	assert.Error(t, err, "KindMax still applies")
+}
+
+func TestController_acquireFailureKeepsKey(t *testing.T) {
+	t.Parallel()
+
+	queue := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[any]())
+	defer queue.ShutDown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := &controller{
+		ctx:       ctx,
+		workqueue: queue,
+		limiter:   NewWorkerBudget(WorkerBudgetOptions{MaxConcurrent: 1}).ForKind(schema.GroupVersionKind{Version: "v1", Kind: "Pod"}),
+	}
+	// exhaust the budget, so the next acquire fails on the cancelled context
+	_, err := c.limiter.Acquire(context.Background())
+	require.NoError(t, err)
+
+	queue.Add("test-ns/test-pod")
+	assert.False(t, c.processNextWorkItem())
+	assert.Equal(t, 0, queue.Len())
+	assert.Equal(t, []startKey{{key: "test-ns/test-pod"}}, c.startKeys, "the key is kept for the next start")
+
+	// the next start replaces the workqueue, replaying the kept keys
+	c.startKeys = nil
+	c.workqueue = workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[any]())
+	defer c.workqueue.ShutDown()
+	queue.Add("test-ns/other-pod")
+	obj, _ := queue.Get()
+	c.keepForRestart(queue, obj)
+	assert.Empty(t, c.startKeys)
+	assert.Equal(t, 1, c.workqueue.Len(), "added to the new workqueue once started")
+}
+
+func TestController_acquireFailureKeepsBatch(t *testing.T) {
+	t.Parallel()
+
+	queue := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[any]())
+	defer queue.ShutDown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := &controller{
+		ctx:       ctx,
+		workqueue: queue,
+		limiter:   NewWorkerBudget(WorkerBudgetOptions{MaxConcurrent: 1}).ForKind(schema.GroupVersionKind{Version: "v1", Kind: "Pod"}),
+	}
+	_, err := c.limiter.Acquire(context.Background())
+	require.NoError(t, err)
+
+	queue.Add("test-ns/a")
+	queue.Add("test-ns/b")
+	a, _ := queue.Get()
+	b, _ := queue.Get()
+	assert.False(t, c.processBatch([]any{a, b}))
+	assert.Equal(t, []startKey{{key: "test-ns/a"}, {key: "test-ns/b"}}, c.startKeys)
+}
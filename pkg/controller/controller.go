@@ -8,6 +8,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"strings"
 	"sync"
 	"time"
@@ -48,6 +49,9 @@ type Controller interface {
 	Enqueue(namespace, name string)
 	EnqueueAfter(namespace, name string, delay time.Duration)
 	EnqueueKey(key string)
+	// EnqueueWithPriority enqueues a key with the given priority, which is only honored if the controller uses a
+	// PriorityQueue. Otherwise, it is equivalent to Enqueue.
+	EnqueueWithPriority(namespace, name string, priority Priority)
 	Informer() cache.SharedIndexInformer
 	Start(ctx context.Context, workers int) error
 }
@@ -65,16 +69,48 @@ type controller struct {
 	startKeys   []startKey
 	started     bool
 	startCache  func(context.Context) error
+	sharder     Sharder
+	newQueue    QueueFactory
+	priorities  map[EventSource]Priority
+	prioritizer PriorityQueue
+	limiter     ConcurrencyLimiter
+	debouncer   *debouncer
+	ctx         context.Context
+	// batchHandler is only set when batching is enabled
+	batchHandler BatchHandler
+	batch        BatchOptions
+
+	rebalanceLock sync.Mutex
+	// ownedKeys are the keys owned at the last rebalance
+	ownedKeys map[string]bool
 }
 
 type startKey struct {
-	key   string
-	after time.Duration
+	key      string
+	after    time.Duration
+	priority Priority
 }
 
 type Options struct {
 	RateLimiter            workqueue.TypedRateLimiter[any]
 	SyncOnlyChangedObjects bool
+	// Sharder, if set, restricts the controller to the keys owned by the current replica. Keys owned by other
+	// replicas are dropped when enqueued, their owner observing the same events through its own informer.
+	Sharder Sharder
+	// QueueFactory, if set, replaces the FIFO ordering of the workqueue, see NewFairQueueFactory and NewPriorityQueueFactory.
+	QueueFactory QueueFactory
+	// EventPriorities overrides the priority given to keys depending on what enqueued them, when using a
+	// PriorityQueue. By default, resyncs get PriorityLow, manual enqueues PriorityHigh and everything else
+	// PriorityNormal.
+	EventPriorities map[EventSource]Priority
+	// ConcurrencyLimiter, if set, must be acquired before reconciling every key, see WorkerBudget.
+	ConcurrencyLimiter ConcurrencyLimiter
+	// Debounce, if set, delays the keys enqueued by informer events so bursts of events are reconciled once.
+	// Keys enqueued through Enqueue, EnqueueAfter or EnqueueKey are never delayed.
+	Debounce Debounce
+	// Batch, if its Size is greater than 1, makes the controller drain many keys at once from the workqueue and pass
+	// them to the handler, which must implement BatchHandler.
+	Batch BatchOptions
 }
 
 func New(name string, informer cache.SharedIndexInformer, startCache func(context.Context) error, handler Handler, opts *Options) Controller {
@@ -86,18 +122,36 @@ func New(name string, informer cache.SharedIndexInformer, startCache func(contex
 		informer:    informer,
 		rateLimiter: opts.RateLimiter,
 		startCache:  startCache,
+		sharder:     opts.Sharder,
+		newQueue:    opts.QueueFactory,
+		priorities:  opts.EventPriorities,
+		limiter:     opts.ConcurrencyLimiter,
+	}
+	controller.debouncer = newDebouncer(opts.Debounce, controller.enqueueKey)
+	if batchHandler, ok := handler.(BatchHandler); ok && opts.Batch.Size > 1 {
+		controller.batchHandler = batchHandler
+		controller.batch = opts.Batch
 	}
 
 	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: controller.handleObject,
+		AddFunc: func(obj interface{}) {
+			controller.handleObject(obj, EventAdd)
+		},
 		UpdateFunc: func(old, new interface{}) {
-			if !opts.SyncOnlyChangedObjects || old.(ResourceVersionGetter).GetResourceVersion() != new.(ResourceVersionGetter).GetResourceVersion() {
+			changed := old.(ResourceVersionGetter).GetResourceVersion() != new.(ResourceVersionGetter).GetResourceVersion()
+			if !opts.SyncOnlyChangedObjects || changed {
 				// If syncOnlyChangedObjects is disabled, objects will be handled regardless of whether an update actually took place.
 				// Otherwise, objects will only be handled if they have changed
-				controller.handleObject(new)
+				source := EventUpdate
+				if !changed {
+					source = EventResync
+				}
+				controller.handleObject(new, source)
 			}
 		},
-		DeleteFunc: controller.handleObject,
+		DeleteFunc: func(obj interface{}) {
+			controller.handleObject(obj, EventDelete)
+		},
 	})
 	if err != nil {
 		log.Errorf("error adding event handler: %v", err)
@@ -121,6 +175,10 @@ func applyDefaultOptions(opts *Options) *Options {
 			workqueue.NewTypedItemExponentialFailureRateLimiter[any](5*time.Millisecond, 30*time.Second),
 		)
 	}
+
+	priorities := maps.Clone(defaultEventPriorities)
+	maps.Copy(priorities, newOpts.EventPriorities)
+	newOpts.EventPriorities = priorities
 	return &newOpts
 }
 
@@ -138,8 +196,9 @@ func (c *controller) run(workers int, stopCh <-chan struct{}) {
 	// will create a goroutine under the hood.  It we instantiate a workqueue we must have
 	// a mechanism to Shutdown it down.  Without the stopCh we don't know when to shutdown
 	// the queue and release the goroutine
-	c.workqueue = workqueue.NewTypedRateLimitingQueueWithConfig(c.rateLimiter, workqueue.TypedRateLimitingQueueConfig[any]{Name: c.name})
+	c.workqueue = c.newWorkqueue()
 	for _, start := range c.startKeys {
+		c.prioritize(start.key, start.priority)
 		if start.after == 0 {
 			c.workqueue.Add(start.key)
 		} else {
@@ -157,8 +216,16 @@ func (c *controller) run(workers int, stopCh <-chan struct{}) {
 	// Start the informer factories to begin populating the informer caches
 	log.Infof("Starting %s controller", c.name)
 
-	for i := 0; i < workers; i++ {
-		go wait.Until(c.runWorker, time.Second, stopCh)
+	if c.batchHandler != nil {
+		items := make(chan []any)
+		go c.fetchItems(items, stopCh)
+		for i := 0; i < workers; i++ {
+			go wait.Until(func() { c.runBatchWorker(items) }, time.Second, stopCh)
+		}
+	} else {
+		for i := 0; i < workers; i++ {
+			go wait.Until(c.runWorker, time.Second, stopCh)
+		}
 	}
 
 	<-stopCh
@@ -168,6 +235,22 @@ func (c *controller) run(workers int, stopCh <-chan struct{}) {
 	log.Infof("Shutting down %s workers", c.name)
 }
 
+func (c *controller) newWorkqueue() workqueue.TypedRateLimitingInterface[any] {
+	config := workqueue.TypedRateLimitingQueueConfig[any]{Name: c.name}
+	if c.newQueue != nil {
+		queue := c.newQueue(c.name)
+		c.prioritizer, _ = queue.(PriorityQueue)
+		config.DelayingQueue = workqueue.NewTypedDelayingQueueWithConfig(workqueue.TypedDelayingQueueConfig[any]{
+			Name: c.name,
+			Queue: workqueue.NewTypedWithConfig(workqueue.TypedQueueConfig[any]{
+				Name:  c.name,
+				Queue: queue,
+			}),
+		})
+	}
+	return workqueue.NewTypedRateLimitingQueueWithConfig(c.rateLimiter, config)
+}
+
 func (c *controller) Start(ctx context.Context, workers int) error {
 	c.startLock.Lock()
 	defer c.startLock.Unlock()
@@ -185,33 +268,92 @@ func (c *controller) Start(ctx context.Context, workers int) error {
 	}
 
 	c.ctxID = metrics.ContextID(ctx)
+	c.ctx = ctx
 	go c.run(workers, ctx.Done())
 	c.started = true
+
+	if c.sharder != nil {
+		c.sharder.OnChange(ctx, c.rebalance)
+		// ownership may have been established before the callback was registered
+		go c.rebalance()
+	}
 	return nil
 }
 
+// rebalance enqueues the cached keys gained by this replica since the last rebalance, so they are reconciled after a
+// membership change. Keys that were lost are dropped when dequeued.
+func (c *controller) rebalance() {
+	c.rebalanceLock.Lock()
+	defer c.rebalanceLock.Unlock()
+
+	owned := map[string]bool{}
+	for _, key := range c.informer.GetStore().ListKeys() {
+		if !c.sharder.Owns(key) {
+			continue
+		}
+		owned[key] = true
+		if !c.ownedKeys[key] {
+			c.enqueueKey(key, c.priorities[EventResync])
+		}
+	}
+	c.ownedKeys = owned
+}
+
+func (c *controller) owns(key string) bool {
+	return c.sharder == nil || c.sharder.Owns(key)
+}
+
 func (c *controller) runWorker() {
 	for c.processNextWorkItem() {
 	}
 }
 
 func (c *controller) processNextWorkItem() bool {
-	obj, shutdown := c.workqueue.Get()
+	queue := c.workqueue
+	obj, shutdown := queue.Get()
 
 	if shutdown {
 		return false
 	}
 
-	if err := c.processSingleItem(obj); err != nil {
-		if !strings.Contains(err.Error(), "please apply your changes to the latest version and try again") {
-			log.Errorf("%v", err)
-		}
-		return true
+	release, err := c.acquire()
+	if err != nil {
+		c.keepForRestart(queue, obj)
+		queue.Done(obj)
+		return false
 	}
 
+	err = c.processSingleItem(obj)
+	release(err)
+	c.logSyncError(err)
+
 	return true
 }
 
+func (c *controller) logSyncError(err error) {
+	if err != nil && !strings.Contains(err.Error(), "please apply your changes to the latest version and try again") {
+		log.Errorf("%v", err)
+	}
+}
+
+func (c *controller) acquire() (func(error), error) {
+	if c.limiter == nil {
+		return func(error) {}, nil
+	}
+
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	waitStartTS := time.Now()
+	release, err := c.limiter.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	metrics.ReportConcurrencyWaitTime(c.ctxID, c.name, time.Since(waitStartTS).Seconds())
+	return release, nil
+}
+
 func (c *controller) processSingleItem(obj interface{}) error {
 	var (
 		key string
@@ -221,22 +363,42 @@ func (c *controller) processSingleItem(obj interface{}) error {
 	defer c.workqueue.Done(obj)
 
 	if key, ok = obj.(string); !ok {
-		c.workqueue.Forget(obj)
+		c.forget(obj)
 		log.Errorf("expected string in workqueue but got %#v", obj)
 		return nil
 	}
-	if err := c.syncHandler(key); err != nil {
-		var retryAfter *retryAfterError
-		if errors.As(err, &retryAfter) {
-			c.workqueue.AddAfter(key, retryAfter.duration)
-			return retryAfter.error
-		}
-		c.workqueue.AddRateLimited(key)
-		return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
+	if !c.owns(key) {
+		c.forget(obj)
+		return nil
 	}
+	return c.handleResult(key, c.syncHandler(key))
+}
 
+// forget drops an item that will not be processed
+func (c *controller) forget(obj any) {
+	c.servedPriority(obj)
 	c.workqueue.Forget(obj)
-	return nil
+}
+
+// handleResult forgets or requeues a key depending on the outcome of its reconcile. Requeued keys keep the priority
+// they were served with.
+func (c *controller) handleResult(key string, err error) error {
+	priority, prioritized := c.servedPriority(key)
+	if err == nil {
+		c.workqueue.Forget(key)
+		return nil
+	}
+	if prioritized {
+		c.prioritize(key, priority)
+	}
+
+	var retryAfter *retryAfterError
+	if errors.As(err, &retryAfter) {
+		c.workqueue.AddAfter(key, retryAfter.duration)
+		return retryAfter.error
+	}
+	c.workqueue.AddRateLimited(key)
+	return fmt.Errorf("error syncing '%s': %w, requeuing", key, err)
 }
 
 func (c *controller) syncHandler(key string) error {
@@ -253,42 +415,103 @@ func (c *controller) syncHandler(key string) error {
 }
 
 func (c *controller) EnqueueKey(key string) {
+	c.enqueueKey(key, c.priorities[EventManual])
+}
+
+func (c *controller) enqueueKey(key string, priority Priority) {
+	if !c.owns(key) {
+		return
+	}
+
 	c.startLock.Lock()
 	defer c.startLock.Unlock()
 
 	if c.workqueue == nil {
-		c.startKeys = append(c.startKeys, startKey{key: key})
+		c.startKeys = append(c.startKeys, startKey{key: key, priority: priority})
 	} else {
+		c.prioritize(key, priority)
 		c.workqueue.Add(key)
 	}
 }
 
 func (c *controller) Enqueue(namespace, name string) {
+	c.EnqueueWithPriority(namespace, name, c.priorities[EventManual])
+}
+
+func (c *controller) EnqueueWithPriority(namespace, name string, priority Priority) {
 	key := keyFunc(namespace, name)
+	if !c.owns(key) {
+		return
+	}
 
 	c.startLock.Lock()
 	defer c.startLock.Unlock()
 
 	if c.workqueue == nil {
-		c.startKeys = append(c.startKeys, startKey{key: key})
+		c.startKeys = append(c.startKeys, startKey{key: key, priority: priority})
 	} else {
+		c.prioritize(key, priority)
 		c.workqueue.AddRateLimited(key)
 	}
 }
 
 func (c *controller) EnqueueAfter(namespace, name string, duration time.Duration) {
 	key := keyFunc(namespace, name)
+	if !c.owns(key) {
+		return
+	}
 
 	c.startLock.Lock()
 	defer c.startLock.Unlock()
 
+	priority := c.priorities[EventManual]
 	if c.workqueue == nil {
-		c.startKeys = append(c.startKeys, startKey{key: key, after: duration})
+		c.startKeys = append(c.startKeys, startKey{key: key, after: duration, priority: priority})
 	} else {
+		c.prioritize(key, priority)
 		c.workqueue.AddAfter(key, duration)
 	}
 }
 
+// prioritize sets the priority of a key about to be added to the workqueue, it must be called while holding startLock
+// keepForRestart keeps a key dequeued from queue while the controller is shutting down, so it is processed once the
+// controller starts again with a new workqueue. The key is added to the new workqueue if it already replaced queue.
+func (c *controller) keepForRestart(queue workqueue.TypedRateLimitingInterface[any], obj any) {
+	priority, prioritized := c.servedPriority(obj)
+	key, ok := obj.(string)
+	if !ok {
+		return
+	}
+	if !prioritized {
+		priority = c.priorities[EventResync]
+	}
+
+	c.startLock.Lock()
+	defer c.startLock.Unlock()
+
+	if c.workqueue != nil && c.workqueue != queue {
+		c.prioritize(key, priority)
+		c.workqueue.Add(key)
+	} else {
+		c.startKeys = append(c.startKeys, startKey{key: key, priority: priority})
+	}
+}
+
+// servedPriority returns the priority a dequeued item was served with, if the workqueue is a priority queue created by
+// NewPriorityQueueFactory. It must be called once per dequeued item.
+func (c *controller) servedPriority(obj any) (Priority, bool) {
+	if queue, ok := c.prioritizer.(*priorityQueue); ok {
+		return queue.takeServed(obj)
+	}
+	return 0, false
+}
+
+func (c *controller) prioritize(key string, priority Priority) {
+	if c.prioritizer != nil {
+		c.prioritizer.SetPriority(key, priority)
+	}
+}
+
 func keyFunc(namespace, name string) string {
 	if namespace == "" {
 		return name
@@ -296,23 +519,21 @@ func keyFunc(namespace, name string) string {
 	return namespace + "/" + name
 }
 
-func (c *controller) enqueue(obj interface{}) {
+func (c *controller) enqueue(obj interface{}, source EventSource) {
 	var key string
 	var err error
 	if key, err = cache.MetaNamespaceKeyFunc(obj); err != nil {
 		log.Errorf("%v", err)
 		return
 	}
-	c.startLock.Lock()
-	if c.workqueue == nil {
-		c.startKeys = append(c.startKeys, startKey{key: key})
-	} else {
-		c.workqueue.Add(key)
+	if c.debouncer != nil {
+		c.debouncer.add(key, c.priorities[source])
+		return
 	}
-	c.startLock.Unlock()
+	c.enqueueKey(key, c.priorities[source])
 }
 
-func (c *controller) handleObject(obj interface{}) {
+func (c *controller) handleObject(obj interface{}, source EventSource) {
 	if _, ok := obj.(metav1.Object); !ok {
 		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
 		if !ok {
@@ -326,5 +547,5 @@ func (c *controller) handleObject(obj interface{}) {
 		}
 		obj = newObj
 	}
-	c.enqueue(obj)
+	c.enqueue(obj, source)
 }
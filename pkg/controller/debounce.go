@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultDebounceMaxWaitFactor = 10
+
+// Debounce collapses the events received for a key within a window into a single reconcile.
+type Debounce struct {
+	// Window is how long to wait for more events of a key before enqueuing it, every new event extending the wait.
+	// Zero disables debouncing.
+	Window time.Duration
+	// MaxWait caps how long a key under constant churn is delayed after its first event, defaults to 10 times Window.
+	// A MaxWait shorter than Window is raised to Window.
+	MaxWait time.Duration
+}
+
+type debouncer struct {
+	window  time.Duration
+	maxWait time.Duration
+	enqueue func(key string, priority Priority)
+
+	lock    sync.Mutex
+	pending map[string]*debouncedKey
+}
+
+type debouncedKey struct {
+	first    time.Time
+	deadline time.Time
+	priority Priority
+	timer    *time.Timer
+}
+
+func newDebouncer(opts Debounce, enqueue func(key string, priority Priority)) *debouncer {
+	if opts.Window <= 0 {
+		return nil
+	}
+	if opts.MaxWait <= 0 {
+		opts.MaxWait = defaultDebounceMaxWaitFactor * opts.Window
+	} else if opts.MaxWait < opts.Window {
+		opts.MaxWait = opts.Window
+	}
+	return &debouncer{
+		window:  opts.Window,
+		maxWait: opts.MaxWait,
+		enqueue: enqueue,
+		pending: map[string]*debouncedKey{},
+	}
+}
+
+func (d *debouncer) add(key string, priority Priority) {
+	now := time.Now()
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	pending, ok := d.pending[key]
+	if !ok {
+		pending = &debouncedKey{
+			first:    now,
+			deadline: now.Add(d.window),
+			priority: priority,
+		}
+		pending.timer = time.AfterFunc(d.window, func() {
+			d.fire(key)
+		})
+		d.pending[key] = pending
+		return
+	}
+
+	// the timer is not reset here, it reschedules itself when firing before the extended deadline
+	pending.deadline = now.Add(d.window)
+	if maxDeadline := pending.first.Add(d.maxWait); pending.deadline.After(maxDeadline) {
+		pending.deadline = maxDeadline
+	}
+	if priority > pending.priority {
+		pending.priority = priority
+	}
+}
+
+func (d *debouncer) fire(key string) {
+	d.lock.Lock()
+	pending := d.pending[key]
+	if remaining := time.Until(pending.deadline); remaining > 0 {
+		pending.timer.Reset(remaining)
+		d.lock.Unlock()
+		return
+	}
+	delete(d.pending, key)
+	d.lock.Unlock()
+
+	d.enqueue(key, pending.priority)
+}
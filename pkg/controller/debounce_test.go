@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebouncer(t *testing.T) {
+	t.Parallel()
+
+	var lock sync.Mutex
+	enqueued := map[string]int{}
+	d := newDebouncer(Debounce{Window: 50 * time.Millisecond, MaxWait: 200 * time.Millisecond}, func(key string, priority Priority) {
+		lock.Lock()
+		defer lock.Unlock()
+		enqueued[key]++
+	})
+	count := func(key string) int {
+		lock.Lock()
+		defer lock.Unlock()
+		return enqueued[key]
+	}
+
+	// a burst of events is collapsed into a single enqueue
+	for i := 0; i < 5; i++ {
+		d.add("ns/burst", PriorityNormal)
+	}
+	assert.Eventually(t, func() bool { return count("ns/burst") == 1 }, time.Second, 10*time.Millisecond)
+
+	// a key under constant churn is still enqueued once MaxWait elapsed
+	start := time.Now()
+	for time.Since(start) < 300*time.Millisecond {
+		d.add("ns/churn", PriorityNormal)
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.GreaterOrEqual(t, count("ns/churn"), 1)
+	assert.Equal(t, 1, count("ns/burst"))
+
+	assert.Nil(t, newDebouncer(Debounce{}, nil))
+}
+
+func TestNewDebouncer_maxWait(t *testing.T) {
+	t.Parallel()
+
+	window := 50 * time.Millisecond
+	assert.Equal(t, 10*window, newDebouncer(Debounce{Window: window}, nil).maxWait, "defaults to 10 times Window")
+	assert.Equal(t, window, newDebouncer(Debounce{Window: window, MaxWait: 20 * time.Millisecond}, nil).maxWait, "raised to Window")
+	assert.Equal(t, 2*window, newDebouncer(Debounce{Window: window, MaxWait: 2 * window}, nil).maxWait)
+}
@@ -26,6 +26,9 @@ func (n *errorController) EnqueueAfter(namespace, name string, delay time.Durati
 func (n *errorController) EnqueueKey(key string) {
 }
 
+func (n *errorController) EnqueueWithPriority(namespace, name string, priority Priority) {
+}
+
 func (n *errorController) Informer() cache.SharedIndexInformer {
 	return n.informer
 }
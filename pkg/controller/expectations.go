@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rancher/lasso/pkg/cache"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const defaultExpectationsTimeout = 5 * time.Minute
+
+// Expectations records the writes performed by handlers for a key, so the key is not reconciled again until the cache
+// observed them. This prevents, for instance, creating the same child twice because the next reconcile ran before the
+// informer of the children received the first creation.
+//
+// Creations and deletions are not observed automatically: they are usually reported by an event handler on the
+// children, see SharedController.Watches. Expected resource versions are observed from the cached object of the key.
+// Expectations that are not observed within the timeout are dropped.
+type Expectations struct {
+	timeout time.Duration
+	enqueue func(key string)
+
+	lock sync.Mutex
+	keys map[string]*expectation
+}
+
+type expectation struct {
+	adds            int
+	deletes         int
+	resourceVersion string
+	timestamp       time.Time
+}
+
+// NewExpectations creates an Expectations calling enqueue once the pending creations and deletions of a key were all
+// observed. A zero timeout defaults to 5 minutes.
+func NewExpectations(timeout time.Duration, enqueue func(key string)) *Expectations {
+	if timeout <= 0 {
+		timeout = defaultExpectationsTimeout
+	}
+	return &Expectations{
+		timeout: timeout,
+		enqueue: enqueue,
+		keys:    map[string]*expectation{},
+	}
+}
+
+// ExpectCreations records that count objects are going to be created by the reconcile of key
+func (e *Expectations) ExpectCreations(key string, count int) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.get(key).adds += count
+}
+
+// ExpectDeletions records that count objects are going to be deleted by the reconcile of key
+func (e *Expectations) ExpectDeletions(key string, count int) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.get(key).deletes += count
+}
+
+// ExpectResourceVersion records that the object of key was written, its reconcile being deferred until the cache holds
+// the given resourceVersion or a newer one.
+func (e *Expectations) ExpectResourceVersion(key, resourceVersion string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.get(key).resourceVersion = resourceVersion
+}
+
+// CreationObserved records that one of the creations expected for key was seen in the cache
+func (e *Expectations) CreationObserved(key string) {
+	e.observed(key, func(exp *expectation) bool {
+		if exp.adds <= 0 {
+			return false
+		}
+		exp.adds--
+		return true
+	})
+}
+
+// DeletionObserved records that one of the deletions expected for key was seen in the cache
+func (e *Expectations) DeletionObserved(key string) {
+	e.observed(key, func(exp *expectation) bool {
+		if exp.deletes <= 0 {
+			return false
+		}
+		exp.deletes--
+		return true
+	})
+}
+
+// Satisfied returns whether key can be reconciled given its cached object, or how long to wait before the pending
+// expectations time out.
+func (e *Expectations) Satisfied(key string, obj runtime.Object) (bool, time.Duration) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	exp, ok := e.keys[key]
+	if !ok {
+		return true, 0
+	}
+
+	remaining := e.timeout - time.Since(exp.timestamp)
+	if remaining <= 0 {
+		delete(e.keys, key)
+		return true, 0
+	}
+	if exp.resourceVersion != "" && obj != nil && resourceVersionObserved(obj, exp.resourceVersion) {
+		exp.resourceVersion = ""
+	}
+	if exp.adds > 0 || exp.deletes > 0 || exp.resourceVersion != "" {
+		return false, remaining
+	}
+
+	delete(e.keys, key)
+	return true, 0
+}
+
+// Delete drops the expectations of key, for instance once its object was deleted
+func (e *Expectations) Delete(key string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	delete(e.keys, key)
+}
+
+// get must be called while holding the lock
+func (e *Expectations) get(key string) *expectation {
+	exp, ok := e.keys[key]
+	if !ok {
+		exp = &expectation{}
+		e.keys[key] = exp
+	}
+	exp.timestamp = time.Now()
+	return exp
+}
+
+func (e *Expectations) observed(key string, update func(exp *expectation) bool) {
+	e.lock.Lock()
+	exp, ok := e.keys[key]
+	satisfied := ok && update(exp) && exp.adds <= 0 && exp.deletes <= 0
+	e.lock.Unlock()
+
+	if satisfied && e.enqueue != nil {
+		e.enqueue(key)
+	}
+}
+
+func resourceVersionObserved(obj runtime.Object, expected string) bool {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return true
+	}
+	return cache.ResourceVersionReached(m.GetResourceVersion(), expected)
+}
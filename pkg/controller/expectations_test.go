@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestExpectations(t *testing.T) {
+	t.Parallel()
+
+	var enqueued []string
+	e := NewExpectations(time.Minute, func(key string) {
+		enqueued = append(enqueued, key)
+	})
+	obj := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "cm", ResourceVersion: "10"}}
+
+	satisfied, _ := e.Satisfied("ns/cm", obj)
+	assert.True(t, satisfied, "keys without expectations are always satisfied")
+
+	e.ExpectCreations("ns/cm", 2)
+	e.ExpectDeletions("ns/cm", 1)
+	satisfied, remaining := e.Satisfied("ns/cm", obj)
+	assert.False(t, satisfied)
+	assert.Greater(t, remaining, 59*time.Second)
+
+	e.CreationObserved("ns/cm")
+	e.CreationObserved("ns/cm")
+	assert.Empty(t, enqueued)
+	e.DeletionObserved("ns/cm")
+	assert.Equal(t, []string{"ns/cm"}, enqueued, "the key is enqueued once every expectation was observed")
+	satisfied, _ = e.Satisfied("ns/cm", obj)
+	assert.True(t, satisfied)
+
+	e.ExpectResourceVersion("ns/cm", "11")
+	satisfied, _ = e.Satisfied("ns/cm", obj)
+	assert.False(t, satisfied, "the cache holds an older version")
+	obj.ResourceVersion = "12"
+	satisfied, _ = e.Satisfied("ns/cm", obj)
+	assert.True(t, satisfied)
+
+	// expectations time out
+	e = NewExpectations(time.Millisecond, nil)
+	e.ExpectCreations("ns/cm", 1)
+	time.Sleep(5 * time.Millisecond)
+	satisfied, _ = e.Satisfied("ns/cm", obj)
+	assert.True(t, satisfied)
+}
+
+func TestSharedHandler_expectations(t *testing.T) {
+	t.Parallel()
+
+	handler := &SharedHandler{Expectations: NewExpectations(time.Minute, nil)}
+	var calls int
+	handler.Register(t.Context(), "test", SharedControllerHandlerFunc(func(string, runtime.Object) (runtime.Object, error) {
+		calls++
+		return nil, nil
+	}))
+	obj := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "cm"}}
+
+	handler.Expectations.ExpectCreations("ns/cm", 1)
+	err := handler.OnChange("ns/cm", obj)
+	var retryAfter *retryAfterError
+	if assert.ErrorAs(t, err, &retryAfter) {
+		assert.Greater(t, retryAfter.duration, 59*time.Second)
+	}
+	assert.Equal(t, 0, calls, "handlers are not called while expectations are pending")
+
+	handler.Expectations.CreationObserved("ns/cm")
+	assert.NoError(t, handler.OnChange("ns/cm", obj))
+	assert.Equal(t, 1, calls)
+}
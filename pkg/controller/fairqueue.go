@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"strings"
+
+	"github.com/rancher/lasso/pkg/metrics"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// QueueFactory creates the queue ordering the keys waiting to be reconciled by the named controller.
+// The workqueue wrapping it still handles deduplication, delays and rate limiting.
+type QueueFactory func(name string) workqueue.Queue[any]
+
+// PartitionFunc returns the partition a workqueue item belongs to
+type PartitionFunc func(item any) string
+
+// NamespacePartition partitions keys by namespace, cluster-scoped keys sharing the empty partition
+func NamespacePartition(item any) string {
+	key, _ := item.(string)
+	namespace, _, found := strings.Cut(key, "/")
+	if !found {
+		return ""
+	}
+	return namespace
+}
+
+type FairQueueOptions struct {
+	// Partition determines the partition of every key, defaults to NamespacePartition
+	Partition PartitionFunc
+	// Weights is the number of keys served from a partition on each round, partitions not listed get 1
+	Weights map[string]int
+}
+
+// NewFairQueueFactory returns a QueueFactory serving partitions in a weighted round-robin fashion, so a partition
+// holding many keys, like a namespace being resynced, does not delay the keys of every other partition.
+func NewFairQueueFactory(opts FairQueueOptions) QueueFactory {
+	if opts.Partition == nil {
+		opts.Partition = NamespacePartition
+	}
+	return func(name string) workqueue.Queue[any] {
+		return &fairQueue{
+			name:       name,
+			partition:  opts.Partition,
+			weights:    opts.Weights,
+			partitions: map[string][]any{},
+		}
+	}
+}
+
+// fairQueue implements workqueue.Queue, which is only accessed while holding the lock of the wrapping workqueue
+type fairQueue struct {
+	name      string
+	partition PartitionFunc
+	weights   map[string]int
+
+	partitions map[string][]any
+	// order holds the non-empty partitions in the order they are served
+	order   []string
+	current int
+	served  int
+	length  int
+}
+
+func (f *fairQueue) Touch(item any) {}
+
+func (f *fairQueue) Push(item any) {
+	partition := f.partition(item)
+	items, ok := f.partitions[partition]
+	if !ok {
+		f.order = append(f.order, partition)
+	}
+	f.partitions[partition] = append(items, item)
+	f.length++
+	metrics.SetQueuePartitionDepth(f.name, partition, len(f.partitions[partition]))
+}
+
+func (f *fairQueue) Len() int {
+	return f.length
+}
+
+func (f *fairQueue) Pop() any {
+	if f.length == 0 {
+		return nil
+	}
+
+	partition := f.order[f.current]
+	items := f.partitions[partition]
+	item := items[0]
+	// avoid memory leaks, as the backing array is kept until the partition empties
+	items[0] = nil
+	items = items[1:]
+	f.length--
+	f.served++
+
+	if len(items) == 0 {
+		delete(f.partitions, partition)
+		f.order = append(f.order[:f.current], f.order[f.current+1:]...)
+		f.served = 0
+		if f.current >= len(f.order) {
+			f.current = 0
+		}
+		metrics.DelQueuePartitionDepth(f.name, partition)
+		return item
+	}
+
+	f.partitions[partition] = items
+	metrics.SetQueuePartitionDepth(f.name, partition, len(items))
+	if f.served >= f.weight(partition) {
+		f.current = (f.current + 1) % len(f.order)
+		f.served = 0
+	}
+	return item
+}
+
+func (f *fairQueue) weight(partition string) int {
+	if w := f.weights[partition]; w > 0 {
+		return w
+	}
+	return 1
+}
@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestFairQueue_round_robin(t *testing.T) {
+	t.Parallel()
+
+	q := NewFairQueueFactory(FairQueueOptions{
+		Weights: map[string]int{"heavy": 2},
+	})("test")
+
+	for _, key := range []string{"big/1", "big/2", "big/3", "small/1", "heavy/1", "heavy/2", "heavy/3", "cluster-scoped"} {
+		q.Push(key)
+	}
+	assert.Equal(t, 8, q.Len())
+
+	var got []any
+	for q.Len() > 0 {
+		got = append(got, q.Pop())
+	}
+	assert.Equal(t, []any{
+		"big/1", "small/1", "heavy/1", "heavy/2", "cluster-scoped",
+		"big/2", "heavy/3",
+		"big/3",
+	}, got)
+	assert.Nil(t, q.Pop())
+}
+
+func TestFairQueue_keeps_workqueue_deduplication(t *testing.T) {
+	t.Parallel()
+
+	q := workqueue.NewTypedWithConfig(workqueue.TypedQueueConfig[any]{
+		Queue: NewFairQueueFactory(FairQueueOptions{})("test"),
+	})
+	defer q.ShutDown()
+
+	q.Add("a/1")
+	q.Add("a/1")
+	q.Add("b/1")
+	assert.Equal(t, 2, q.Len())
+
+	item, _ := q.Get()
+	assert.Equal(t, "a/1", item)
+	// re-adding an item being processed only requeues it once done
+	q.Add("a/1")
+	assert.Equal(t, 1, q.Len())
+	q.Done(item)
+	assert.Equal(t, 2, q.Len())
+}
@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"slices"
+
+	"github.com/rancher/lasso/pkg/client"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+)
+
+// FinalizerFunc cleans up after an object being deleted. The finalizer is removed once it returns without error.
+type FinalizerFunc func(key string, obj runtime.Object) error
+
+func (s *sharedController) RegisterFinalizer(ctx context.Context, finalizerName string, cleanup FinalizerFunc) {
+	s.RegisterHandler(ctx, finalizerName, &finalizerHandler{
+		ctx:     ctx,
+		name:    finalizerName,
+		client:  s.client,
+		cleanup: cleanup,
+	})
+}
+
+type finalizerHandler struct {
+	ctx     context.Context
+	name    string
+	client  *client.Client
+	cleanup FinalizerFunc
+}
+
+func (f *finalizerHandler) OnChange(key string, obj runtime.Object) (runtime.Object, error) {
+	if obj == nil {
+		return nil, nil
+	}
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	hasFinalizer := slices.Contains(m.GetFinalizers(), f.name)
+	if m.GetDeletionTimestamp() == nil {
+		if hasFinalizer {
+			return obj, nil
+		}
+		return f.patchFinalizers(obj, func(finalizers []string) []string {
+			return append(finalizers, f.name)
+		})
+	}
+
+	if !hasFinalizer {
+		return obj, nil
+	}
+	if err := f.cleanup(key, obj); err != nil {
+		return obj, err
+	}
+	// the returned object lets SharedHandler notice the removal of the last finalizer, see wasFinalized
+	return f.patchFinalizers(obj, func(finalizers []string) []string {
+		return slices.DeleteFunc(finalizers, func(finalizer string) bool {
+			return finalizer == f.name
+		})
+	})
+}
+
+// patchFinalizers sets the finalizers computed by update with a merge patch including the resourceVersion, so the
+// patch fails on conflict instead of overwriting finalizers changed concurrently. On conflict, the object is read
+// again from the API server.
+func (f *finalizerHandler) patchFinalizers(obj runtime.Object, update func(finalizers []string) []string) (runtime.Object, error) {
+	var result runtime.Object
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		m, err := meta.Accessor(obj)
+		if err != nil {
+			return err
+		}
+
+		current := slices.Contains(m.GetFinalizers(), f.name)
+		finalizers := update(slices.Clone(m.GetFinalizers()))
+		if current == slices.Contains(finalizers, f.name) {
+			// the latest version of the object is already in the desired state
+			result = obj
+			return nil
+		}
+
+		patch, err := json.Marshal(map[string]any{
+			"metadata": map[string]any{
+				"finalizers":      finalizers,
+				"resourceVersion": m.GetResourceVersion(),
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		patched := newEmptyObject(obj)
+		err = f.client.Patch(f.ctx, m.GetNamespace(), m.GetName(), types.MergePatchType, patch, patched, metav1.PatchOptions{})
+		if err == nil {
+			result = patched
+			return nil
+		} else if apierrors.IsNotFound(err) {
+			result = obj
+			return nil
+		}
+
+		if apierrors.IsConflict(err) {
+			latest := newEmptyObject(obj)
+			if getErr := f.client.Get(f.ctx, m.GetNamespace(), m.GetName(), latest, metav1.GetOptions{}); getErr == nil {
+				obj = latest
+			}
+		}
+		return err
+	})
+	return result, err
+}
+
+func newEmptyObject(obj runtime.Object) runtime.Object {
+	return reflect.New(reflect.TypeOf(obj).Elem()).Interface().(runtime.Object)
+}
@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/rancher/lasso/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest/fake"
+	"k8s.io/utils/ptr"
+)
+
+func TestFinalizerHandler(t *testing.T) {
+	t.Parallel()
+
+	const finalizer = "test.cattle.io/cleanup"
+	newConfigMap := func(resourceVersion string, deleting bool, finalizers ...string) *corev1.ConfigMap {
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "ns",
+			Name:            "cm",
+			UID:             "uid",
+			ResourceVersion: resourceVersion,
+			Finalizers:      finalizers,
+		}}
+		if deleting {
+			cm.DeletionTimestamp = ptr.To(metav1.Now())
+		}
+		return cm
+	}
+	respond := func(code int, obj runtime.Object) (*http.Response, error) {
+		body, err := runtime.Encode(scheme.Codecs.LegacyCodec(corev1.SchemeGroupVersion), obj)
+		if err != nil {
+			return nil, err
+		}
+		return &http.Response{
+			StatusCode: code,
+			Header:     http.Header{"Content-Type": []string{runtime.ContentTypeJSON}},
+			Body:       io.NopCloser(bytes.NewReader(body)),
+		}, nil
+	}
+	type patchBody struct {
+		Metadata struct {
+			Finalizers      []string `json:"finalizers"`
+			ResourceVersion string   `json:"resourceVersion"`
+		} `json:"metadata"`
+	}
+
+	t.Run("adds the finalizer", func(t *testing.T) {
+		t.Parallel()
+
+		var patches []patchBody
+		restClient := &fake.RESTClient{
+			GroupVersion:         corev1.SchemeGroupVersion,
+			NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+			Client: fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+				var patch patchBody
+				require.NoError(t, json.NewDecoder(req.Body).Decode(&patch))
+				patches = append(patches, patch)
+				return respond(http.StatusOK, newConfigMap("2", false, patch.Metadata.Finalizers...))
+			}),
+		}
+		handler := &finalizerHandler{
+			ctx:    t.Context(),
+			name:   finalizer,
+			client: client.NewClient(corev1.SchemeGroupVersion.WithResource("configmaps"), "ConfigMap", true, restClient, 0),
+			cleanup: func(string, runtime.Object) error {
+				t.Error("cleanup called on an object not being deleted")
+				return nil
+			},
+		}
+
+		obj, err := handler.OnChange("ns/cm", newConfigMap("1", false))
+		require.NoError(t, err)
+		require.Len(t, patches, 1)
+		assert.Equal(t, []string{finalizer}, patches[0].Metadata.Finalizers)
+		assert.Equal(t, "1", patches[0].Metadata.ResourceVersion)
+		assert.Equal(t, []string{finalizer}, obj.(*corev1.ConfigMap).Finalizers)
+
+		// nothing to do once the finalizer is set
+		_, err = handler.OnChange("ns/cm", obj)
+		require.NoError(t, err)
+		assert.Len(t, patches, 1)
+	})
+
+	t.Run("removes the finalizer after cleanup, retrying on conflict", func(t *testing.T) {
+		t.Parallel()
+
+		var patches []patchBody
+		restClient := &fake.RESTClient{
+			GroupVersion:         corev1.SchemeGroupVersion,
+			NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+			Client: fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+				if req.Method == http.MethodGet {
+					// another finalizer was added concurrently
+					return respond(http.StatusOK, newConfigMap("2", true, "other", finalizer))
+				}
+				var patch patchBody
+				require.NoError(t, json.NewDecoder(req.Body).Decode(&patch))
+				patches = append(patches, patch)
+				if patch.Metadata.ResourceVersion != "2" {
+					return respond(http.StatusConflict, &metav1.Status{
+						Status: metav1.StatusFailure,
+						Code:   http.StatusConflict,
+						Reason: metav1.StatusReasonConflict,
+					})
+				}
+				return respond(http.StatusOK, newConfigMap("3", true, patch.Metadata.Finalizers...))
+			}),
+		}
+		var cleanups int
+		handler := &finalizerHandler{
+			ctx:    t.Context(),
+			name:   finalizer,
+			client: client.NewClient(corev1.SchemeGroupVersion.WithResource("configmaps"), "ConfigMap", true, restClient, 0),
+			cleanup: func(string, runtime.Object) error {
+				cleanups++
+				return nil
+			},
+		}
+
+		obj, err := handler.OnChange("ns/cm", newConfigMap("1", true, finalizer))
+		require.NoError(t, err)
+		assert.Equal(t, 1, cleanups)
+		require.Len(t, patches, 2)
+		assert.Empty(t, patches[0].Metadata.Finalizers)
+		assert.Equal(t, []string{"other"}, patches[1].Metadata.Finalizers)
+		assert.Equal(t, []string{"other"}, obj.(*corev1.ConfigMap).Finalizers)
+	})
+}
@@ -16,6 +16,8 @@ import (
 
 	client "github.com/rancher/lasso/pkg/client"
 	gomock "go.uber.org/mock/gomock"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
 	cache "k8s.io/client-go/tools/cache"
 )
 
@@ -93,6 +95,46 @@ func (mr *MockSharedControllerMockRecorder) EnqueueKey(key any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnqueueKey", reflect.TypeOf((*MockSharedController)(nil).EnqueueKey), key)
 }
 
+// EnqueueOwners mocks base method.
+func (m *MockSharedController) EnqueueOwners(child runtime.Object) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnqueueOwners", child)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnqueueOwners indicates an expected call of EnqueueOwners.
+func (mr *MockSharedControllerMockRecorder) EnqueueOwners(child any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnqueueOwners", reflect.TypeOf((*MockSharedController)(nil).EnqueueOwners), child)
+}
+
+// EnqueueWithPriority mocks base method.
+func (m *MockSharedController) EnqueueWithPriority(namespace, name string, priority Priority) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "EnqueueWithPriority", namespace, name, priority)
+}
+
+// EnqueueWithPriority indicates an expected call of EnqueueWithPriority.
+func (mr *MockSharedControllerMockRecorder) EnqueueWithPriority(namespace, name, priority any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnqueueWithPriority", reflect.TypeOf((*MockSharedController)(nil).EnqueueWithPriority), namespace, name, priority)
+}
+
+// Expectations mocks base method.
+func (m *MockSharedController) Expectations() *Expectations {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Expectations")
+	ret0, _ := ret[0].(*Expectations)
+	return ret0
+}
+
+// Expectations indicates an expected call of Expectations.
+func (mr *MockSharedControllerMockRecorder) Expectations() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Expectations", reflect.TypeOf((*MockSharedController)(nil).Expectations))
+}
+
 // Informer mocks base method.
 func (m *MockSharedController) Informer() cache.SharedIndexInformer {
 	m.ctrl.T.Helper()
@@ -107,6 +149,45 @@ func (mr *MockSharedControllerMockRecorder) Informer() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Informer", reflect.TypeOf((*MockSharedController)(nil).Informer))
 }
 
+// ListChildren mocks base method.
+func (m *MockSharedController) ListChildren(owner runtime.Object) ([]runtime.Object, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListChildren", owner)
+	ret0, _ := ret[0].([]runtime.Object)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListChildren indicates an expected call of ListChildren.
+func (mr *MockSharedControllerMockRecorder) ListChildren(owner any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListChildren", reflect.TypeOf((*MockSharedController)(nil).ListChildren), owner)
+}
+
+// RegisterBatchHandler mocks base method.
+func (m *MockSharedController) RegisterBatchHandler(ctx context.Context, name string, handler BatchHandler) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RegisterBatchHandler", ctx, name, handler)
+}
+
+// RegisterBatchHandler indicates an expected call of RegisterBatchHandler.
+func (mr *MockSharedControllerMockRecorder) RegisterBatchHandler(ctx, name, handler any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterBatchHandler", reflect.TypeOf((*MockSharedController)(nil).RegisterBatchHandler), ctx, name, handler)
+}
+
+// RegisterFinalizer mocks base method.
+func (m *MockSharedController) RegisterFinalizer(ctx context.Context, finalizerName string, cleanup FinalizerFunc) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RegisterFinalizer", ctx, finalizerName, cleanup)
+}
+
+// RegisterFinalizer indicates an expected call of RegisterFinalizer.
+func (mr *MockSharedControllerMockRecorder) RegisterFinalizer(ctx, finalizerName, cleanup any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterFinalizer", reflect.TypeOf((*MockSharedController)(nil).RegisterFinalizer), ctx, finalizerName, cleanup)
+}
+
 // RegisterHandler mocks base method.
 func (m *MockSharedController) RegisterHandler(ctx context.Context, name string, handler SharedControllerHandler) {
 	m.ctrl.T.Helper()
@@ -132,3 +213,17 @@ func (mr *MockSharedControllerMockRecorder) Start(ctx, workers any) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Start", reflect.TypeOf((*MockSharedController)(nil).Start), ctx, workers)
 }
+
+// Watches mocks base method.
+func (m *MockSharedController) Watches(ctx context.Context, gvk schema.GroupVersionKind, mapFunc MapFunc) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Watches", ctx, gvk, mapFunc)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Watches indicates an expected call of Watches.
+func (mr *MockSharedControllerMockRecorder) Watches(ctx, gvk, mapFunc any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Watches", reflect.TypeOf((*MockSharedController)(nil).Watches), ctx, gvk, mapFunc)
+}
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/retry"
+)
+
+// MutateFunc modifies obj in place
+type MutateFunc func(obj runtime.Object) error
+
+// Mutate applies mutate to a copy of the cached object and updates it through the client of the SharedController,
+// reading the object again and retrying on conflict. No request is sent if mutate did not change the object. A NotFound
+// error is returned if the object is not cached.
+func Mutate(ctx context.Context, controller SharedController, namespace, name string, mutate MutateFunc) (runtime.Object, error) {
+	return mutateWithRetry(ctx, controller, namespace, name, mutate, false)
+}
+
+// MutateStatus is like Mutate, but updates the status subresource of the object
+func MutateStatus(ctx context.Context, controller SharedController, namespace, name string, mutate MutateFunc) (runtime.Object, error) {
+	return mutateWithRetry(ctx, controller, namespace, name, mutate, true)
+}
+
+func mutateWithRetry(ctx context.Context, controller SharedController, namespace, name string, mutate MutateFunc, status bool) (runtime.Object, error) {
+	client := controller.Client()
+	current, err := getCached(controller, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var result runtime.Object
+	err = retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		obj := current.DeepCopyObject()
+		if err := mutate(obj); err != nil {
+			return err
+		}
+		if equality.Semantic.DeepEqual(current, obj) {
+			result = current
+			return nil
+		}
+
+		updated := newEmptyObject(obj)
+		var err error
+		if status {
+			err = client.UpdateStatus(ctx, namespace, obj, updated, metav1.UpdateOptions{})
+		} else {
+			err = client.Update(ctx, namespace, obj, updated, metav1.UpdateOptions{})
+		}
+		if err == nil {
+			result = updated
+			return nil
+		}
+
+		if apierrors.IsConflict(err) {
+			latest := newEmptyObject(obj)
+			if getErr := client.Get(ctx, namespace, name, latest, metav1.GetOptions{}); getErr != nil {
+				return getErr
+			}
+			current = latest
+		}
+		return err
+	})
+	return result, err
+}
+
+func getCached(controller SharedController, namespace, name string) (runtime.Object, error) {
+	key := name
+	if namespace != "" {
+		key = namespace + "/" + name
+	}
+	cached, exists, err := controller.Informer().GetStore().GetByKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, apierrors.NewNotFound(controller.Client().GVR.GroupResource(), name)
+	}
+	return cached.(runtime.Object), nil
+}
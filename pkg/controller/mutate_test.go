@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/rancher/lasso/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestMutate(t *testing.T) {
+	t.Parallel()
+
+	newConfigMap := func(resourceVersion string, data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "cm", ResourceVersion: resourceVersion},
+			Data:       data,
+		}
+	}
+	respond := func(code int, obj runtime.Object) (*http.Response, error) {
+		body, err := runtime.Encode(scheme.Codecs.LegacyCodec(corev1.SchemeGroupVersion), obj)
+		if err != nil {
+			return nil, err
+		}
+		return &http.Response{
+			StatusCode: code,
+			Header:     http.Header{"Content-Type": []string{runtime.ContentTypeJSON}},
+			Body:       io.NopCloser(bytes.NewReader(body)),
+		}, nil
+	}
+
+	var updates []*corev1.ConfigMap
+	restClient := &fake.RESTClient{
+		GroupVersion:         corev1.SchemeGroupVersion,
+		NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+		Client: fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+			if req.Method == http.MethodGet {
+				// the object was modified concurrently
+				return respond(http.StatusOK, newConfigMap("2", map[string]string{"other": "value"}))
+			}
+			cm := &corev1.ConfigMap{}
+			require.NoError(t, json.NewDecoder(req.Body).Decode(cm))
+			updates = append(updates, cm)
+			if cm.ResourceVersion != "2" {
+				return respond(http.StatusConflict, &apierrors.NewConflict(corev1.Resource("configmaps"), "cm", nil).ErrStatus)
+			}
+			cm.ResourceVersion = "3"
+			return respond(http.StatusOK, cm)
+		}),
+	}
+
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	require.NoError(t, store.Add(newConfigMap("1", nil)))
+	ctrl := gomock.NewController(t)
+	informer := NewMockSharedIndexInformer(ctrl)
+	informer.EXPECT().GetStore().Return(store).AnyTimes()
+	configMaps := NewMockSharedController(ctrl)
+	configMaps.EXPECT().Informer().Return(informer).AnyTimes()
+	configMaps.EXPECT().Client().Return(client.NewClient(corev1.SchemeGroupVersion.WithResource("configmaps"), "ConfigMap", true, restClient, 0)).AnyTimes()
+
+	setKey := func(obj runtime.Object) error {
+		cm := obj.(*corev1.ConfigMap)
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data["key"] = "value"
+		return nil
+	}
+
+	obj, err := Mutate(t.Context(), configMaps, "ns", "cm", setKey)
+	require.NoError(t, err)
+	require.Len(t, updates, 2, "the conflicting update is retried")
+	cm := obj.(*corev1.ConfigMap)
+	assert.Equal(t, "3", cm.ResourceVersion)
+	assert.Equal(t, map[string]string{"other": "value", "key": "value"}, cm.Data)
+
+	// nothing is sent when the object is already up to date
+	require.NoError(t, store.Update(cm))
+	obj, err = Mutate(t.Context(), configMaps, "ns", "cm", setKey)
+	require.NoError(t, err)
+	assert.Len(t, updates, 2)
+	assert.Equal(t, cm, obj)
+
+	_, err = Mutate(t.Context(), configMaps, "ns", "missing", setKey)
+	assert.True(t, apierrors.IsNotFound(err))
+}
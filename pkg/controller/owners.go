@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/rancher/lasso/pkg/cache"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func (s *sharedController) ListChildren(owner runtime.Object) ([]runtime.Object, error) {
+	ownerMeta, err := meta.Accessor(owner)
+	if err != nil {
+		return nil, err
+	}
+	uid := string(ownerMeta.GetUID())
+
+	indexer := s.Informer().GetIndexer()
+	if _, ok := indexer.GetIndexers()[cache.OwnerUIDIndex]; ok {
+		objs, err := indexer.ByIndex(cache.OwnerUIDIndex, uid)
+		if err != nil {
+			return nil, err
+		}
+		return toRuntimeObjects(objs), nil
+	}
+
+	// the cache was created without the owner index, fall back to scanning it
+	var children []interface{}
+	for _, obj := range indexer.List() {
+		uids, err := cache.OwnerUIDIndexFunc(obj)
+		if err != nil {
+			return nil, err
+		}
+		for _, ownerUID := range uids {
+			if ownerUID == uid {
+				children = append(children, obj)
+				break
+			}
+		}
+	}
+	return toRuntimeObjects(children), nil
+}
+
+func (s *sharedController) EnqueueOwners(child runtime.Object) error {
+	if s.controllerForKind == nil {
+		return fmt.Errorf("shared controller was not created from a SharedControllerFactory")
+	}
+	childMeta, err := meta.Accessor(child)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range childMeta.GetOwnerReferences() {
+		gvk := schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind)
+		owner, err := s.controllerForKind(gvk)
+		if err != nil {
+			return fmt.Errorf("looking up controller of owner %s %s: %w", gvk, ref.Name, err)
+		}
+
+		switch {
+		case !owner.Client().Namespaced:
+			owner.EnqueueKey(ref.Name)
+		case childMeta.GetNamespace() != "":
+			owner.EnqueueKey(childMeta.GetNamespace() + "/" + ref.Name)
+		default:
+			// cluster-scoped objects cannot be owned by namespaced objects
+		}
+	}
+	return nil
+}
+
+func toRuntimeObjects(objs []interface{}) []runtime.Object {
+	result := make([]runtime.Object, 0, len(objs))
+	for _, obj := range objs {
+		if runtimeObj, ok := obj.(runtime.Object); ok {
+			result = append(result, runtimeObj)
+		}
+	}
+	return result
+}
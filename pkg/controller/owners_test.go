@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/rancher/lasso/pkg/cache"
+	"github.com/rancher/lasso/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	cachetools "k8s.io/client-go/tools/cache"
+)
+
+func TestSharedController_ListChildren(t *testing.T) {
+	t.Parallel()
+
+	owner := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "owner", UID: "owner-uid"}}
+	newSecret := func(name string, ownerUID types.UID) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "ns",
+			Name:            name,
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ConfigMap", Name: "owner", UID: ownerUID}},
+		}}
+	}
+
+	for name, indexers := range map[string]cachetools.Indexers{
+		"indexed":     {cache.OwnerUIDIndex: cache.OwnerUIDIndexFunc},
+		"not indexed": {},
+	} {
+		t.Run(name, func(t *testing.T) {
+			informer := cachetools.NewSharedIndexInformer(nil, &corev1.Secret{}, 0, indexers)
+			require.NoError(t, informer.GetStore().Add(newSecret("child", "owner-uid")))
+			require.NoError(t, informer.GetStore().Add(newSecret("other", "other-uid")))
+
+			ctrl := gomock.NewController(t)
+			secrets := NewMockSharedController(ctrl)
+			secrets.EXPECT().Informer().Return(informer).AnyTimes()
+			s := &sharedController{
+				deferredController: func() (Controller, error) {
+					return secrets, nil
+				},
+			}
+
+			children, err := s.ListChildren(owner)
+			require.NoError(t, err)
+			require.Len(t, children, 1)
+			assert.Equal(t, "child", children[0].(*corev1.Secret).Name)
+		})
+	}
+}
+
+func TestSharedController_EnqueueOwners(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	configMaps := NewMockSharedController(ctrl)
+	configMaps.EXPECT().Client().Return(&client.Client{Namespaced: true}).AnyTimes()
+	nodes := NewMockSharedController(ctrl)
+	nodes.EXPECT().Client().Return(&client.Client{}).AnyTimes()
+
+	s := &sharedController{
+		controllerForKind: func(gvk schema.GroupVersionKind) (SharedController, error) {
+			if gvk.Kind == "Node" {
+				return nodes, nil
+			}
+			return configMaps, nil
+		},
+	}
+
+	configMaps.EXPECT().EnqueueKey("ns/config")
+	nodes.EXPECT().EnqueueKey("node")
+	require.NoError(t, s.EnqueueOwners(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "ns",
+		Name:      "child",
+		OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: "v1", Kind: "ConfigMap", Name: "config"},
+			{APIVersion: "v1", Kind: "Node", Name: "node"},
+		},
+	}}))
+
+	// a cluster-scoped child cannot reference a namespaced owner
+	require.NoError(t, s.EnqueueOwners(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:            "ns",
+		OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ConfigMap", Name: "config"}},
+	}}))
+}
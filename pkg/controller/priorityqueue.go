@@ -0,0 +1,242 @@
+package controller
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sync"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+const defaultStarvationLimit = 10
+
+// Priority orders keys waiting in a priority queue, higher priorities being served first
+type Priority int
+
+const (
+	PriorityLow    Priority = -100
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 100
+)
+
+// EventSource identifies what caused a key to be enqueued
+type EventSource string
+
+const (
+	EventAdd    EventSource = "add"
+	EventUpdate EventSource = "update"
+	EventDelete EventSource = "delete"
+	// EventResync is an update where the object did not change, usually caused by the informer's periodic resync
+	EventResync EventSource = "resync"
+	// EventManual is an explicit call to Enqueue, EnqueueAfter or EnqueueKey
+	EventManual EventSource = "manual"
+)
+
+var defaultEventPriorities = map[EventSource]Priority{
+	EventAdd:    PriorityNormal,
+	EventUpdate: PriorityNormal,
+	EventDelete: PriorityNormal,
+	EventResync: PriorityLow,
+	EventManual: PriorityHigh,
+}
+
+// PriorityQueue is a workqueue.Queue that can serve some items before others.
+type PriorityQueue interface {
+	workqueue.Queue[any]
+	// SetPriority sets the priority of an item about to be added to the workqueue. If the item is already waiting,
+	// it is moved to a higher lane but never to a lower one.
+	SetPriority(item any, priority Priority)
+}
+
+type PriorityQueueOptions struct {
+	// Lane creates the queue ordering the items of a single priority, defaults to FIFO. A fair queue can be used so
+	// partitions are served fairly within each lane.
+	Lane QueueFactory
+	// StarvationLimit is the number of items that can be served from higher lanes while a lower lane is waiting,
+	// before serving an item from the lower lane. Defaults to 10.
+	StarvationLimit int
+}
+
+// NewPriorityQueueFactory returns a QueueFactory creating a PriorityQueue, which serves higher priority lanes first.
+func NewPriorityQueueFactory(opts PriorityQueueOptions) QueueFactory {
+	if opts.StarvationLimit <= 0 {
+		opts.StarvationLimit = defaultStarvationLimit
+	}
+	return func(name string) workqueue.Queue[any] {
+		return &priorityQueue{
+			name:            name,
+			newLane:         opts.Lane,
+			starvationLimit: opts.StarvationLimit,
+			hints:           map[any]Priority{},
+			served:          map[any]Priority{},
+			lanes:           map[Priority]*priorityLane{},
+			items:           map[any]Priority{},
+		}
+	}
+}
+
+type priorityLane struct {
+	queue workqueue.Queue[any]
+	// live is the number of items in queue that were not moved to a higher lane
+	live    int
+	skipped int
+}
+
+// priorityQueue implements workqueue.Queue. Except for SetPriority, it is only accessed while holding the lock of the
+// wrapping workqueue.
+type priorityQueue struct {
+	name            string
+	newLane         QueueFactory
+	starvationLimit int
+
+	hintLock sync.Mutex
+	hints    map[any]Priority
+	// served holds the priority of the items being processed, so their retries keep it
+	served map[any]Priority
+
+	lanes map[Priority]*priorityLane
+	// priorities holds every lane priority in descending order
+	priorities []Priority
+	// items maps every waiting item to the lane it will be served from
+	items map[any]Priority
+}
+
+func (p *priorityQueue) SetPriority(item any, priority Priority) {
+	p.hintLock.Lock()
+	defer p.hintLock.Unlock()
+
+	if current, ok := p.hints[item]; !ok || priority > current {
+		p.hints[item] = priority
+	}
+}
+
+func (p *priorityQueue) takeHint(item any) (Priority, bool) {
+	p.hintLock.Lock()
+	defer p.hintLock.Unlock()
+
+	priority, ok := p.hints[item]
+	delete(p.hints, item)
+	return priority, ok
+}
+
+// takeServed returns the priority item was last served with, and forgets it
+func (p *priorityQueue) takeServed(item any) (Priority, bool) {
+	p.hintLock.Lock()
+	defer p.hintLock.Unlock()
+
+	priority, ok := p.served[item]
+	delete(p.served, item)
+	return priority, ok
+}
+
+func (p *priorityQueue) lane(priority Priority) *priorityLane {
+	lane, ok := p.lanes[priority]
+	if ok {
+		return lane
+	}
+
+	lane = &priorityLane{}
+	if p.newLane != nil {
+		// lanes are named after their priority so partition metrics of fair lanes do not collide
+		lane.queue = p.newLane(fmt.Sprintf("%s[%d]", p.name, priority))
+	} else {
+		lane.queue = &fifoQueue{}
+	}
+	p.lanes[priority] = lane
+	p.priorities = append(p.priorities, priority)
+	slices.SortFunc(p.priorities, func(a, b Priority) int {
+		return cmp.Compare(b, a)
+	})
+	return lane
+}
+
+func (p *priorityQueue) Touch(item any) {
+	priority, ok := p.takeHint(item)
+	current, queued := p.items[item]
+	if !ok || !queued || priority <= current {
+		return
+	}
+
+	// the copy left in the lower lane is skipped once popped
+	p.lanes[current].live--
+	p.push(item, priority)
+}
+
+func (p *priorityQueue) Push(item any) {
+	priority, ok := p.takeHint(item)
+	if !ok {
+		priority = PriorityNormal
+	}
+	p.push(item, priority)
+}
+
+func (p *priorityQueue) push(item any, priority Priority) {
+	lane := p.lane(priority)
+	lane.queue.Push(item)
+	lane.live++
+	p.items[item] = priority
+}
+
+func (p *priorityQueue) Len() int {
+	return len(p.items)
+}
+
+func (p *priorityQueue) Pop() any {
+	if len(p.items) == 0 {
+		return nil
+	}
+
+	var chosen *priorityLane
+	var chosenPriority Priority
+	for _, priority := range p.priorities {
+		lane := p.lanes[priority]
+		if lane.live == 0 {
+			continue
+		}
+		if chosen == nil {
+			chosen, chosenPriority = lane, priority
+			continue
+		}
+		lane.skipped++
+		if lane.skipped > p.starvationLimit && chosen.skipped <= p.starvationLimit {
+			// serve the highest starving lane to guarantee lower lanes make progress
+			chosen, chosenPriority = lane, priority
+		}
+	}
+	chosen.skipped = 0
+
+	for {
+		item := chosen.queue.Pop()
+		if current, ok := p.items[item]; ok && current == chosenPriority {
+			chosen.live--
+			delete(p.items, item)
+			p.hintLock.Lock()
+			p.served[item] = chosenPriority
+			p.hintLock.Unlock()
+			return item
+		}
+	}
+}
+
+// fifoQueue is the default queue of a priority lane, equivalent to the default workqueue ordering
+type fifoQueue struct {
+	items []any
+}
+
+func (f *fifoQueue) Touch(item any) {}
+
+func (f *fifoQueue) Push(item any) {
+	f.items = append(f.items, item)
+}
+
+func (f *fifoQueue) Len() int {
+	return len(f.items)
+}
+
+func (f *fifoQueue) Pop() any {
+	item := f.items[0]
+	f.items[0] = nil
+	f.items = f.items[1:]
+	return item
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func newTestPriorityQueue(opts PriorityQueueOptions) (PriorityQueue, *workqueue.Typed[any]) {
+	pq := NewPriorityQueueFactory(opts)("test").(PriorityQueue)
+	return pq, workqueue.NewTypedWithConfig(workqueue.TypedQueueConfig[any]{Queue: pq})
+}
+
+func TestPriorityQueue_serves_higher_lanes_first(t *testing.T) {
+	t.Parallel()
+
+	pq, q := newTestPriorityQueue(PriorityQueueOptions{})
+	defer q.ShutDown()
+
+	add := func(key string, priority Priority) {
+		pq.SetPriority(key, priority)
+		q.Add(key)
+	}
+	add("resync-1", PriorityLow)
+	add("resync-2", PriorityLow)
+	add("update", PriorityNormal)
+	add("manual", PriorityHigh)
+	// enqueuing a waiting key with a higher priority moves it to the higher lane
+	add("resync-2", PriorityHigh)
+	// but a lower priority never demotes it
+	add("manual", PriorityLow)
+
+	assert.Equal(t, 4, q.Len())
+	var got []any
+	for q.Len() > 0 {
+		item, _ := q.Get()
+		got = append(got, item)
+		q.Done(item)
+	}
+	assert.Equal(t, []any{"manual", "resync-2", "update", "resync-1"}, got)
+}
+
+func TestPriorityQueue_starvation_protection(t *testing.T) {
+	t.Parallel()
+
+	pq, q := newTestPriorityQueue(PriorityQueueOptions{StarvationLimit: 2})
+	defer q.ShutDown()
+
+	pq.SetPriority("low", PriorityLow)
+	q.Add("low")
+	for _, key := range []string{"high-1", "high-2", "high-3", "high-4"} {
+		pq.SetPriority(key, PriorityHigh)
+		q.Add(key)
+	}
+
+	var got []any
+	for q.Len() > 0 {
+		item, _ := q.Get()
+		got = append(got, item)
+		q.Done(item)
+	}
+	assert.Equal(t, []any{"high-1", "high-2", "low", "high-3", "high-4"}, got)
+}
+
+func TestController_retries_keep_priority(t *testing.T) {
+	t.Parallel()
+
+	c := &controller{
+		name:        "test",
+		newQueue:    NewPriorityQueueFactory(PriorityQueueOptions{}),
+		rateLimiter: workqueue.NewTypedItemExponentialFailureRateLimiter[any](time.Millisecond, time.Millisecond),
+	}
+	c.workqueue = c.newWorkqueue()
+	defer c.workqueue.ShutDown()
+
+	c.enqueueKey("ns/manual", PriorityHigh)
+	key, _ := c.workqueue.Get()
+	assert.Error(t, c.handleResult(key.(string), errors.New("failed")))
+	c.workqueue.Done(key)
+
+	c.enqueueKey("ns/update", PriorityNormal)
+	assert.Eventually(t, func() bool {
+		return c.workqueue.Len() == 2
+	}, 5*time.Second, time.Millisecond)
+	key, _ = c.workqueue.Get()
+	assert.Equal(t, "ns/manual", key, "the retry is served before the keys of lower priority")
+	assert.NoError(t, c.handleResult(key.(string), nil))
+	c.workqueue.Done(key)
+	assert.Empty(t, c.prioritizer.(*priorityQueue).served)
+}
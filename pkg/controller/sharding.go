@@ -0,0 +1,313 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rancher/lasso/pkg/cache"
+	"github.com/rancher/lasso/pkg/client"
+	"github.com/rancher/lasso/pkg/log"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// ShardGroupLabel is set on every Lease used by a LeaseSharder, its value being the group name
+	ShardGroupLabel = "lasso.cattle.io/shard-group"
+
+	defaultShardLeaseNamespace = "kube-system"
+	defaultShardLeaseDuration  = 15 * time.Second
+	defaultShardRenewPeriod    = 5 * time.Second
+	defaultShardVirtualNodes   = 64
+)
+
+// Sharder assigns keys to replicas, so a controller only reconciles the subset of keys owned by the current replica.
+type Sharder interface {
+	// Owns returns whether the given key is assigned to this replica.
+	Owns(key string) bool
+	// OnChange registers a callback that is invoked whenever key ownership may have changed.
+	// The callback is removed once ctx is done.
+	OnChange(ctx context.Context, f func())
+}
+
+// ShardLabelTweakList narrows a cache to the objects labelled with one of the given shard values. It can be used
+// alongside a Sharder when objects are labelled ahead of time, so every replica does not need to cache the whole GVK.
+func ShardLabelTweakList(labelKey string, shards ...string) cache.TweakListOptionsFunc {
+	selector := fmt.Sprintf("%s in (%s)", labelKey, joinSorted(shards))
+	return func(opts *metav1.ListOptions) {
+		if opts.LabelSelector == "" {
+			opts.LabelSelector = selector
+		} else {
+			opts.LabelSelector += "," + selector
+		}
+	}
+}
+
+func joinSorted(values []string) string {
+	values = slices.Clone(values)
+	sort.Strings(values)
+	return strings.Join(values, ",")
+}
+
+type LeaseSharderOptions struct {
+	// Namespace where the membership Leases are stored, defaults to kube-system
+	Namespace string
+	// Group identifies the set of replicas sharing keys, it is used as the Lease name prefix and ShardGroupLabel value
+	Group string
+	// Identity uniquely identifies this replica, defaults to the hostname
+	Identity string
+	// LeaseDuration is how long a replica stays a member after its last renewal, rounded up to a whole number of seconds
+	// as Leases store it in seconds
+	LeaseDuration time.Duration
+	// RenewPeriod is how often the replica renews its own Lease and refreshes the membership list
+	RenewPeriod time.Duration
+	// VirtualNodes is the number of points every member gets on the hash ring
+	VirtualNodes int
+}
+
+// LeaseSharder is a Sharder that assigns keys by consistent hashing over a membership list kept in Leases.
+// Every replica renews its own Lease, and the members are the replicas whose Lease has not expired.
+type LeaseSharder struct {
+	client *client.Client
+	opts   LeaseSharderOptions
+
+	lock      sync.RWMutex
+	ring      *hashRing
+	callbacks cache.CancelCollection
+}
+
+// NewLeaseSharder creates a LeaseSharder storing its Leases through the provided SharedClientFactory.
+// The sharder does not own any key until Start is called and the membership list was read at least once.
+func NewLeaseSharder(clientFactory client.SharedClientFactory, opts LeaseSharderOptions) (*LeaseSharder, error) {
+	if opts.Group == "" {
+		return nil, fmt.Errorf("a group is required for lease sharding")
+	}
+	if opts.Namespace == "" {
+		opts.Namespace = defaultShardLeaseNamespace
+	}
+	if opts.Identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("determining shard identity: %w", err)
+		}
+		opts.Identity = hostname
+	}
+	if opts.LeaseDuration == 0 {
+		opts.LeaseDuration = defaultShardLeaseDuration
+	} else if opts.LeaseDuration < 0 {
+		return nil, fmt.Errorf("invalid shard lease duration %v", opts.LeaseDuration)
+	}
+	if opts.RenewPeriod == 0 {
+		opts.RenewPeriod = defaultShardRenewPeriod
+	}
+	if opts.VirtualNodes == 0 {
+		opts.VirtualNodes = defaultShardVirtualNodes
+	}
+
+	c, err := clientFactory.ForKind(coordinationv1.SchemeGroupVersion.WithKind("Lease"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &LeaseSharder{
+		client: c,
+		opts:   opts,
+	}, nil
+}
+
+// Start renews the Lease of this replica and refreshes the membership list until ctx is done, at which point the
+// Lease is deleted so the remaining replicas can take over its keys without waiting for it to expire.
+func (l *LeaseSharder) Start(ctx context.Context) {
+	go func() {
+		wait.UntilWithContext(ctx, l.refresh, l.opts.RenewPeriod)
+
+		deleteCtx, cancel := context.WithTimeout(context.Background(), l.opts.RenewPeriod)
+		defer cancel()
+		if err := l.client.Delete(deleteCtx, l.opts.Namespace, l.leaseName(), metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			log.Errorf("failed to release shard lease %s/%s: %v", l.opts.Namespace, l.leaseName(), err)
+		}
+	}()
+}
+
+func (l *LeaseSharder) Owns(key string) bool {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	if l.ring == nil {
+		return false
+	}
+	return l.ring.owner(key) == l.opts.Identity
+}
+
+func (l *LeaseSharder) OnChange(ctx context.Context, f func()) {
+	l.callbacks.Add(ctx, f)
+}
+
+// Members returns the identities of the replicas currently sharing keys
+func (l *LeaseSharder) Members() []string {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	if l.ring == nil {
+		return nil
+	}
+	return slices.Clone(l.ring.members)
+}
+
+// leaseDurationSeconds returns LeaseDuration rounded up to a whole number of seconds, so a sub-second duration does
+// not make the Lease expire immediately
+func (l *LeaseSharder) leaseDurationSeconds() int32 {
+	return int32((l.opts.LeaseDuration + time.Second - 1) / time.Second)
+}
+
+func (l *LeaseSharder) leaseName() string {
+	return l.opts.Group + "-" + l.opts.Identity
+}
+
+func (l *LeaseSharder) refresh(ctx context.Context) {
+	if err := l.renew(ctx); err != nil {
+		log.Errorf("failed to renew shard lease %s/%s: %v", l.opts.Namespace, l.leaseName(), err)
+	}
+
+	members, err := l.listMembers(ctx)
+	if err != nil {
+		log.Errorf("failed to list shard members for group %s: %v", l.opts.Group, err)
+		return
+	}
+	l.setMembers(members)
+}
+
+func (l *LeaseSharder) renew(ctx context.Context) error {
+	now := metav1.NewMicroTime(time.Now())
+
+	lease := &coordinationv1.Lease{}
+	err := l.client.Get(ctx, l.opts.Namespace, l.leaseName(), lease, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      l.leaseName(),
+				Namespace: l.opts.Namespace,
+				Labels: map[string]string{
+					ShardGroupLabel: l.opts.Group,
+				},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       ptr.To(l.opts.Identity),
+				LeaseDurationSeconds: ptr.To(l.leaseDurationSeconds()),
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		return l.client.Create(ctx, l.opts.Namespace, lease, &coordinationv1.Lease{}, metav1.CreateOptions{})
+	} else if err != nil {
+		return err
+	}
+
+	lease.Spec.HolderIdentity = ptr.To(l.opts.Identity)
+	lease.Spec.LeaseDurationSeconds = ptr.To(l.leaseDurationSeconds())
+	lease.Spec.RenewTime = &now
+	return l.client.Update(ctx, l.opts.Namespace, lease, &coordinationv1.Lease{}, metav1.UpdateOptions{})
+}
+
+func (l *LeaseSharder) listMembers(ctx context.Context) ([]string, error) {
+	leases := &coordinationv1.LeaseList{}
+	if err := l.client.List(ctx, l.opts.Namespace, leases, metav1.ListOptions{
+		LabelSelector: ShardGroupLabel + "=" + l.opts.Group,
+	}); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var members []string
+	for _, lease := range leases.Items {
+		spec := lease.Spec
+		if spec.HolderIdentity == nil || *spec.HolderIdentity == "" || spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+			continue
+		}
+		expiry := spec.RenewTime.Add(time.Duration(*spec.LeaseDurationSeconds) * time.Second)
+		if expiry.After(now) {
+			members = append(members, *spec.HolderIdentity)
+		}
+	}
+	return members, nil
+}
+
+func (l *LeaseSharder) setMembers(members []string) {
+	sort.Strings(members)
+	members = slices.Compact(members)
+
+	l.lock.Lock()
+	if l.ring != nil && slices.Equal(l.ring.members, members) {
+		l.lock.Unlock()
+		return
+	}
+	l.ring = newHashRing(members, l.opts.VirtualNodes)
+	l.lock.Unlock()
+
+	log.Infof("Shard group %s membership changed: %v", l.opts.Group, members)
+	for _, f := range l.callbacks.List() {
+		f.(func())()
+	}
+}
+
+// hashRing implements consistent hashing, so only the keys of a joining or leaving member are reassigned
+type hashRing struct {
+	members []string
+	points  []uint64
+	owners  map[uint64]string
+}
+
+func newHashRing(members []string, virtualNodes int) *hashRing {
+	r := &hashRing{
+		members: members,
+		owners:  make(map[uint64]string, len(members)*virtualNodes),
+	}
+	for _, member := range members {
+		for i := 0; i < virtualNodes; i++ {
+			point := hashKey(member + "#" + strconv.Itoa(i))
+			r.points = append(r.points, point)
+			r.owners[point] = member
+		}
+	}
+	slices.Sort(r.points)
+	return r
+}
+
+// owner returns the member owning the given key, or an empty string if the ring has no members
+func (r *hashRing) owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	hash := hashKey(key)
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i] >= hash
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	// fnv alone clusters similar inputs, so mix the bits to spread virtual nodes evenly around the ring
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,276 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rancher/lasso/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/ptr"
+)
+
+func TestHashRing_owner(t *testing.T) {
+	t.Parallel()
+
+	members := []string{"a", "b", "c"}
+	ring := newHashRing(members, defaultShardVirtualNodes)
+
+	counts := map[string]int{}
+	owners := map[string]string{}
+	for i := 0; i < 3000; i++ {
+		key := fmt.Sprintf("ns/obj-%d", i)
+		owner := ring.owner(key)
+		assert.Equal(t, owner, ring.owner(key), "ownership must be deterministic")
+		counts[owner]++
+		owners[key] = owner
+	}
+	for _, member := range members {
+		assert.Greater(t, counts[member], 500, "keys should be spread across members, got %v", counts)
+	}
+
+	// removing a member must only reassign the keys it owned
+	ring = newHashRing([]string{"a", "b"}, defaultShardVirtualNodes)
+	for key, previous := range owners {
+		if previous != "c" {
+			assert.Equal(t, previous, ring.owner(key))
+		}
+	}
+
+	assert.Equal(t, "", newHashRing(nil, defaultShardVirtualNodes).owner("ns/obj"))
+}
+
+type fakeSharder struct {
+	owned map[string]bool
+}
+
+func (f *fakeSharder) Owns(key string) bool {
+	return f.owned[key]
+}
+
+func (f *fakeSharder) OnChange(context.Context, func()) {}
+
+func TestController_sharding_drops_unowned_keys(t *testing.T) {
+	t.Parallel()
+
+	queue := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[any]())
+	defer queue.ShutDown()
+	c := &controller{
+		workqueue: queue,
+		sharder:   &fakeSharder{owned: map[string]bool{"ns/mine": true}},
+	}
+
+	c.EnqueueKey("ns/mine")
+	c.EnqueueKey("ns/theirs")
+	c.Enqueue("ns", "theirs")
+
+	assert.Equal(t, 1, queue.Len())
+	key, _ := queue.Get()
+	assert.Equal(t, "ns/mine", key)
+}
+
+func TestController_rebalance_enqueues_gained_keys(t *testing.T) {
+	t.Parallel()
+
+	queue := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[any]())
+	defer queue.ShutDown()
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{}, &corev1.ConfigMap{}, 0, cache.Indexers{})
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, informer.GetStore().Add(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name}}))
+	}
+	sharder := &fakeSharder{owned: map[string]bool{"ns/a": true}}
+	c := &controller{
+		workqueue: queue,
+		informer:  informer,
+		sharder:   sharder,
+	}
+
+	c.rebalance()
+	require.Equal(t, 1, queue.Len())
+	key, _ := queue.Get()
+	assert.Equal(t, "ns/a", key)
+	queue.Done(key)
+
+	sharder.owned["ns/b"] = true
+	c.rebalance()
+	require.Equal(t, 1, queue.Len(), "keys that were already owned are not enqueued again")
+	key, _ = queue.Get()
+	assert.Equal(t, "ns/b", key)
+}
+
+// fakeLeases is an in-memory API server of the Leases of a namespace
+type fakeLeases struct {
+	lock   sync.Mutex
+	leases map[string]*coordinationv1.Lease
+}
+
+func (f *fakeLeases) client() *client.Client {
+	gvr := coordinationv1.SchemeGroupVersion.WithResource("leases")
+	return client.NewClient(gvr, "Lease", true, &fake.RESTClient{
+		GroupVersion:         coordinationv1.SchemeGroupVersion,
+		NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+		Client:               fake.CreateHTTPClient(f.serve),
+	}, 0)
+}
+
+func (f *fakeLeases) serve(req *http.Request) (*http.Response, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	name := path.Base(req.URL.Path)
+	var obj runtime.Object
+	switch req.Method {
+	case http.MethodGet:
+		if name == "leases" {
+			list := &coordinationv1.LeaseList{}
+			for _, lease := range f.leases {
+				list.Items = append(list.Items, *lease)
+			}
+			obj = list
+		} else if lease, ok := f.leases[name]; ok {
+			obj = lease
+		} else {
+			return leaseResponse(http.StatusNotFound, &metav1.Status{Status: metav1.StatusFailure, Code: http.StatusNotFound, Reason: metav1.StatusReasonNotFound})
+		}
+	case http.MethodPost, http.MethodPut:
+		lease := &coordinationv1.Lease{}
+		data, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		if err := runtime.DecodeInto(scheme.Codecs.UniversalDecoder(), data, lease); err != nil {
+			return nil, err
+		}
+		f.leases[lease.Name] = lease
+		obj = lease
+	case http.MethodDelete:
+		delete(f.leases, name)
+		obj = &metav1.Status{Status: metav1.StatusSuccess}
+	}
+	return leaseResponse(http.StatusOK, obj)
+}
+
+func (f *fakeLeases) get(name string) *coordinationv1.Lease {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.leases[name]
+}
+
+func (f *fakeLeases) set(lease *coordinationv1.Lease) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.leases[lease.Name] = lease
+}
+
+func leaseResponse(code int, obj runtime.Object) (*http.Response, error) {
+	body, err := runtime.Encode(scheme.Codecs.LegacyCodec(coordinationv1.SchemeGroupVersion), obj)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: code,
+		Header:     http.Header{"Content-Type": []string{runtime.ContentTypeJSON}},
+		Body:       io.NopCloser(bytes.NewReader(body)),
+	}, nil
+}
+
+func memberLease(identity string, renewed time.Time, seconds int32) *coordinationv1.Lease {
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "group-" + identity,
+			Namespace: "kube-system",
+			Labels:    map[string]string{ShardGroupLabel: "group"},
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       ptr.To(identity),
+			LeaseDurationSeconds: ptr.To(seconds),
+			RenewTime:            ptr.To(metav1.NewMicroTime(renewed)),
+		},
+	}
+}
+
+func TestLeaseSharder(t *testing.T) {
+	t.Parallel()
+
+	leases := &fakeLeases{leases: map[string]*coordinationv1.Lease{}}
+	l := &LeaseSharder{
+		client: leases.client(),
+		opts: LeaseSharderOptions{
+			Namespace:     "kube-system",
+			Group:         "group",
+			Identity:      "a",
+			LeaseDuration: 500 * time.Millisecond,
+			RenewPeriod:   time.Hour,
+			VirtualNodes:  defaultShardVirtualNodes,
+		},
+	}
+	changes := 0
+	l.OnChange(t.Context(), func() { changes++ })
+	assert.False(t, l.Owns("ns/obj"), "nothing is owned before the members are known")
+
+	// acquire
+	l.refresh(t.Context())
+	lease := leases.get("group-a")
+	require.NotNil(t, lease)
+	assert.Equal(t, int32(1), *lease.Spec.LeaseDurationSeconds, "sub-second durations are rounded up")
+	assert.Equal(t, []string{"a"}, l.Members())
+	assert.True(t, l.Owns("ns/obj"))
+	assert.Equal(t, 1, changes)
+
+	// renew
+	renewed := lease.Spec.RenewTime.Time
+	time.Sleep(time.Millisecond)
+	l.refresh(t.Context())
+	assert.True(t, leases.get("group-a").Spec.RenewTime.After(renewed))
+	assert.Equal(t, 1, changes, "unchanged membership")
+
+	// another member joins
+	leases.set(memberLease("b", time.Now(), 15))
+	l.refresh(t.Context())
+	assert.Equal(t, []string{"a", "b"}, l.Members())
+	assert.Equal(t, 2, changes)
+	owned := 0
+	for i := 0; i < 100; i++ {
+		if l.Owns(fmt.Sprintf("ns/obj-%d", i)) {
+			owned++
+		}
+	}
+	assert.Greater(t, owned, 0)
+	assert.Less(t, owned, 100, "keys are shared with the other member")
+
+	// the other member expires
+	leases.set(memberLease("b", time.Now().Add(-time.Minute), 15))
+	l.refresh(t.Context())
+	assert.Equal(t, []string{"a"}, l.Members())
+	assert.Equal(t, 3, changes)
+
+	// the lease is released once stopped
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	l.Start(ctx)
+	assert.Eventually(t, func() bool {
+		return leases.get("group-a") == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestNewLeaseSharder_invalidLeaseDuration(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewLeaseSharder(nil, LeaseSharderOptions{Group: "group", Identity: "a", LeaseDuration: -time.Second})
+	assert.Error(t, err)
+}
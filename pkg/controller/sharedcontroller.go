@@ -8,6 +8,7 @@ import (
 	"github.com/rancher/lasso/pkg/client"
 	"github.com/rancher/lasso/pkg/metrics"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	cachetools "k8s.io/client-go/tools/cache"
 )
 
@@ -19,6 +20,21 @@ type SharedController interface {
 	Controller
 
 	RegisterHandler(ctx context.Context, name string, handler SharedControllerHandler)
+	// RegisterBatchHandler adds a handler receiving many keys at once, see SharedControllerFactoryOptions.KindBatch.
+	// Unless batching is enabled for the kind, it is called with a single key at a time.
+	RegisterBatchHandler(ctx context.Context, name string, handler BatchHandler)
+	// Watches enqueues the keys returned by mapFunc every time an object of the given GroupVersionKind changes, until
+	// ctx is done. See MapOwners, MapSelector and MapIndex.
+	Watches(ctx context.Context, gvk schema.GroupVersionKind, mapFunc MapFunc) error
+	// RegisterFinalizer adds the given finalizer to every object and, once an object is being deleted, removes it after
+	// cleanup succeeded.
+	RegisterFinalizer(ctx context.Context, finalizerName string, cleanup FinalizerFunc)
+	// Expectations returns the writes expected by the handlers, deferring the reconcile of keys until observed
+	Expectations() *Expectations
+	// ListChildren returns the cached objects owned by the given object, using cache.OwnerUIDIndex when available
+	ListChildren(owner runtime.Object) ([]runtime.Object, error)
+	// EnqueueOwners enqueues the owners of the given object in the controllers of their kinds
+	EnqueueOwners(child runtime.Object) error
 	Client() *client.Client
 }
 
@@ -38,6 +54,8 @@ type sharedController struct {
 	started            bool
 	startError         error
 	client             *client.Client
+	// controllerForKind looks up the controllers of the secondary kinds used by Watches
+	controllerForKind func(gvk schema.GroupVersionKind) (SharedController, error)
 }
 
 func (s *sharedController) Enqueue(namespace, name string) {
@@ -52,6 +70,10 @@ func (s *sharedController) EnqueueKey(key string) {
 	s.initController().EnqueueKey(key)
 }
 
+func (s *sharedController) EnqueueWithPriority(namespace, name string, priority Priority) {
+	s.initController().EnqueueWithPriority(namespace, name, priority)
+}
+
 func (s *sharedController) Informer() cachetools.SharedIndexInformer {
 	return s.initController().Informer()
 }
@@ -60,6 +82,10 @@ func (s *sharedController) Client() *client.Client {
 	return s.client
 }
 
+func (s *sharedController) Expectations() *Expectations {
+	return s.handler.Expectations
+}
+
 func (s *sharedController) initController() Controller {
 	s.startLock.Lock()
 	defer s.startLock.Unlock()
@@ -112,13 +138,26 @@ func (s *sharedController) RegisterHandler(ctx context.Context, name string, han
 
 	getHandlerTransaction(ctx).do(func() {
 		s.handler.Register(ctx, name, handler)
+		s.enqueueAllIfStarted(c)
+	})
+}
 
-		s.startLock.Lock()
-		defer s.startLock.Unlock()
-		if s.started {
-			for _, key := range c.Informer().GetStore().ListKeys() {
-				c.EnqueueKey(key)
-			}
-		}
+func (s *sharedController) RegisterBatchHandler(ctx context.Context, name string, handler BatchHandler) {
+	// Ensure that controller is initialized
+	c := s.initController()
+
+	getHandlerTransaction(ctx).do(func() {
+		s.handler.RegisterBatch(ctx, name, handler)
+		s.enqueueAllIfStarted(c)
 	})
 }
+
+func (s *sharedController) enqueueAllIfStarted(c Controller) {
+	s.startLock.Lock()
+	defer s.startLock.Unlock()
+	if s.started {
+		for _, key := range c.Informer().GetStore().ListKeys() {
+			c.EnqueueKey(key)
+		}
+	}
+}
@@ -2,10 +2,14 @@ package controller
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/rancher/lasso/pkg/cache"
 	"github.com/rancher/lasso/pkg/client"
+	"github.com/rancher/lasso/pkg/log"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -13,6 +17,12 @@ import (
 	"k8s.io/client-go/util/workqueue"
 )
 
+const defaultReadYourWritesTimeout = 10 * time.Second
+
+// ErrWriteNotObserved is returned by the writes of the SharedController clients whose cache did not observe the
+// written object within ReadYourWritesTimeout, although the write itself succeeded
+var ErrWriteNotObserved = errors.New("the cache did not observe the write in time")
+
 type SharedControllerFactory interface {
 	ForObject(obj runtime.Object) (SharedController, error)
 	ForKind(gvk schema.GroupVersionKind) (SharedController, error)
@@ -25,11 +35,51 @@ type SharedControllerFactory interface {
 type SharedControllerFactoryOptions struct {
 	CacheOptions *cache.SharedCacheFactoryOptions
 
-	DefaultRateLimiter workqueue.TypedRateLimiter[any]
-	DefaultWorkers     int
+	DefaultRateLimiter  workqueue.TypedRateLimiter[any]
+	DefaultWorkers      int
+	DefaultQueueFactory QueueFactory
+	DefaultDebounce     Debounce
+
+	KindRateLimiter  map[schema.GroupVersionKind]workqueue.TypedRateLimiter[any]
+	KindWorkers      map[schema.GroupVersionKind]int
+	KindQueueFactory map[schema.GroupVersionKind]QueueFactory
+	KindDebounce     map[schema.GroupVersionKind]Debounce
+
+	// KindBatch makes the controllers of the given GroupVersionKinds hand many keys at once to their handlers, see
+	// SharedController.RegisterBatchHandler.
+	KindBatch map[schema.GroupVersionKind]BatchOptions
+
+	// EventPriorities overrides the priority of keys depending on what enqueued them, see Options.EventPriorities.
+	EventPriorities map[EventSource]Priority
+
+	// WorkerBudget, if set, caps the number of concurrent reconciles across all the controllers of the factory,
+	// regardless of how many workers each of them runs.
+	WorkerBudget *WorkerBudgetOptions
+
+	// AdaptiveConcurrency, if set, shrinks the concurrency of every controller when the API server throttles requests
+	// and grows it back when healthy. NewSharedControllerFactoryFromConfigWithOptions observes the API responses
+	// automatically, otherwise AdaptiveConcurrency.WrapTransport must be set up on the config of the client factory, or
+	// only the reconcile errors and durations are used.
+	AdaptiveConcurrency *AdaptiveConcurrency
+
+	// ExpectationsTimeout is how long the reconcile of a key is deferred when the writes expected through
+	// SharedController.Expectations are not observed, defaults to 5 minutes.
+	ExpectationsTimeout time.Duration
+
+	// ReadYourWrites makes the writes of the SharedController clients return only once the cache of the controller
+	// observed the written object, so handlers reading the cache right after a write do not get the previous version
+	// of the object. Writes not observed within ReadYourWritesTimeout return ErrWriteNotObserved.
+	ReadYourWrites bool
+	// ReadYourWritesTimeout is how long writes wait for the cache with ReadYourWrites, defaults to 10 seconds
+	ReadYourWritesTimeout time.Duration
+
+	// StaleObjectExpiration and StaleObjectRetryPeriod configure how handlers are protected from running on cached
+	// objects older than their last write, see SharedHandler.
+	StaleObjectExpiration  time.Duration
+	StaleObjectRetryPeriod time.Duration
 
-	KindRateLimiter map[schema.GroupVersionKind]workqueue.TypedRateLimiter[any]
-	KindWorkers     map[schema.GroupVersionKind]int
+	// KindSharder splits the keys of the given GroupVersionKinds across replicas, see Options.Sharder.
+	KindSharder map[schema.GroupVersionKind]Sharder
 
 	// SyncOnlyChangedObjects causes the handle function to only proceed if the object was actually updated.
 	// This is intended to be used by applications with many objects and/or controllers types that have
@@ -53,6 +103,22 @@ type sharedControllerFactory struct {
 	workers         int
 	kindRateLimiter map[schema.GroupVersionKind]workqueue.TypedRateLimiter[any]
 	kindWorkers     map[schema.GroupVersionKind]int
+	kindSharder     map[schema.GroupVersionKind]Sharder
+
+	queueFactory          QueueFactory
+	kindQueueFactory      map[schema.GroupVersionKind]QueueFactory
+	eventPriorities       map[EventSource]Priority
+	debounce              Debounce
+	kindDebounce          map[schema.GroupVersionKind]Debounce
+	kindBatch             map[schema.GroupVersionKind]BatchOptions
+	budget                *WorkerBudget
+	adaptive              *AdaptiveConcurrency
+	expectations          time.Duration
+	readYourWrites        bool
+	readYourWritesTimeout time.Duration
+	informerWaiters       *cache.InformerWaiters
+	staleExpiration       time.Duration
+	staleRetry            time.Duration
 
 	syncOnlyChangedObjects bool
 }
@@ -70,6 +136,10 @@ func NewSharedControllerFactoryFromConfig(config *rest.Config, scheme *runtime.S
 // NewSharedControllerFactoryFromConfigWithOptions accepts options for configuring a new SharedControllerFactory and its
 // cache.
 func NewSharedControllerFactoryFromConfigWithOptions(config *rest.Config, scheme *runtime.Scheme, opts *SharedControllerFactoryOptions) (SharedControllerFactory, error) {
+	if opts != nil && opts.AdaptiveConcurrency != nil {
+		config = rest.CopyConfig(config)
+		config.Wrap(opts.AdaptiveConcurrency.WrapTransport)
+	}
 	cf, err := client.NewSharedClientFactory(config, &client.SharedClientFactoryOptions{
 		Scheme: scheme,
 	})
@@ -85,6 +155,16 @@ func NewSharedControllerFactoryFromConfigWithOptions(config *rest.Config, scheme
 
 func NewSharedControllerFactory(cacheFactory cache.SharedCacheFactory, opts *SharedControllerFactoryOptions) SharedControllerFactory {
 	opts = applyDefaultSharedOptions(opts)
+
+	if opts.AdaptiveConcurrency != nil && !opts.AdaptiveConcurrency.transportWrapped.Load() {
+		log.Infof("Adaptive concurrency only follows the reconciles: its transport is not set up on the API client")
+	}
+
+	var budget *WorkerBudget
+	if opts.WorkerBudget != nil {
+		budget = NewWorkerBudget(*opts.WorkerBudget)
+	}
+
 	return &sharedControllerFactory{
 		sharedCacheFactory:     cacheFactory,
 		controllers:            map[schema.GroupVersionResource]*sharedController{},
@@ -92,6 +172,21 @@ func NewSharedControllerFactory(cacheFactory cache.SharedCacheFactory, opts *Sha
 		kindWorkers:            opts.KindWorkers,
 		rateLimiter:            opts.DefaultRateLimiter,
 		kindRateLimiter:        opts.KindRateLimiter,
+		kindSharder:            opts.KindSharder,
+		queueFactory:           opts.DefaultQueueFactory,
+		kindQueueFactory:       opts.KindQueueFactory,
+		eventPriorities:        opts.EventPriorities,
+		debounce:               opts.DefaultDebounce,
+		kindDebounce:           opts.KindDebounce,
+		kindBatch:              opts.KindBatch,
+		budget:                 budget,
+		adaptive:               opts.AdaptiveConcurrency,
+		expectations:           opts.ExpectationsTimeout,
+		readYourWrites:         opts.ReadYourWrites,
+		readYourWritesTimeout:  opts.ReadYourWritesTimeout,
+		informerWaiters:        cache.NewInformerWaiters(),
+		staleExpiration:        opts.StaleObjectExpiration,
+		staleRetry:             opts.StaleObjectRetryPeriod,
 		syncOnlyChangedObjects: opts.SyncOnlyChangedObjects,
 	}
 }
@@ -104,6 +199,9 @@ func applyDefaultSharedOptions(opts *SharedControllerFactoryOptions) *SharedCont
 	if newOpts.DefaultWorkers == 0 {
 		newOpts.DefaultWorkers = 5
 	}
+	if newOpts.ReadYourWritesTimeout <= 0 {
+		newOpts.ReadYourWritesTimeout = defaultReadYourWritesTimeout
+	}
 	return &newOpts
 }
 
@@ -181,8 +279,15 @@ func (s *sharedControllerFactory) ForResourceKind(gvr schema.GroupVersionResourc
 	}
 
 	client := s.sharedCacheFactory.SharedClientFactory().ForResourceKind(gvr, kind, namespaced)
+	if s.readYourWrites {
+		client = client.WithWriteWaiter(s.cacheWriteWaiter(gvr, kind, namespaced))
+	}
 
-	handler := &SharedHandler{ControllerName: gvr.String()}
+	handler := &SharedHandler{
+		ControllerName:         gvr.String(),
+		StaleObjectExpiration:  s.staleExpiration,
+		StaleObjectRetryPeriod: s.staleRetry,
+	}
 
 	controllerResult = &sharedController{
 		deferredController: func() (Controller, error) {
@@ -210,6 +315,24 @@ func (s *sharedControllerFactory) ForResourceKind(gvr schema.GroupVersionResourc
 				rateLimiter = s.rateLimiter
 			}
 
+			queueFactory, ok := s.kindQueueFactory[gvk]
+			if !ok {
+				queueFactory = s.queueFactory
+			}
+
+			debounce, ok := s.kindDebounce[gvk]
+			if !ok {
+				debounce = s.debounce
+			}
+
+			var adaptiveLimiter, budgetLimiter ConcurrencyLimiter
+			if s.adaptive != nil {
+				adaptiveLimiter = s.adaptive.ForController(gvk.String())
+			}
+			if s.budget != nil {
+				budgetLimiter = s.budget.ForKind(gvk)
+			}
+
 			starter := func(ctx context.Context) error {
 				return s.sharedCacheFactory.StartGVK(ctx, gvk)
 			}
@@ -217,18 +340,48 @@ func (s *sharedControllerFactory) ForResourceKind(gvr schema.GroupVersionResourc
 			c := New(gvk.String(), cache, starter, handler, &Options{
 				RateLimiter:            rateLimiter,
 				SyncOnlyChangedObjects: s.syncOnlyChangedObjects,
+				Sharder:                s.kindSharder[gvk],
+				QueueFactory:           queueFactory,
+				EventPriorities:        s.eventPriorities,
+				ConcurrencyLimiter:     chainLimiters(adaptiveLimiter, budgetLimiter),
+				Debounce:               debounce,
+				Batch:                  s.kindBatch[gvk],
 			})
 
 			return c, err
 		},
-		handler: handler,
-		client:  client,
+		handler:           handler,
+		client:            client,
+		controllerForKind: s.ForKind,
 	}
 
+	handler.Expectations = NewExpectations(s.expectations, controllerResult.EnqueueKey)
+
 	s.controllers[gvr] = controllerResult
 	return controllerResult
 }
 
+// cacheWriteWaiter waits for the cache of the given resource to observe writes, unless the cache is not running
+func (s *sharedControllerFactory) cacheWriteWaiter(gvr schema.GroupVersionResource, kind string, namespaced bool) client.WriteWaiter {
+	return client.WriteWaiterFunc(func(ctx context.Context, key, resourceVersion string) error {
+		informer, err := s.sharedCacheFactory.ForResourceKind(gvr, kind, namespaced)
+		if err != nil {
+			return err
+		}
+		if !informer.HasSynced() {
+			return nil
+		}
+
+		waitCtx, cancel := context.WithTimeout(ctx, s.readYourWritesTimeout)
+		defer cancel()
+		err = s.informerWaiters.WaitForResourceVersion(waitCtx, informer, key, resourceVersion)
+		if err != nil && ctx.Err() == nil {
+			return fmt.Errorf("%w: %s %s at resourceVersion %s after %v", ErrWriteNotObserved, gvr, key, resourceVersion, s.readYourWritesTimeout)
+		}
+		return err
+	})
+}
+
 func (s *sharedControllerFactory) getWorkers(gvr schema.GroupVersionResource, workers int) (int, error) {
 	gvk, err := s.sharedCacheFactory.SharedClientFactory().GVKForResource(gvr)
 	if meta.IsNoMatchError(err) {
@@ -17,10 +17,10 @@ import (
 )
 
 const (
-	// recentDeletionCacheExpiration configures the duration for keeping a history of recently deleted object UIDs
-	recentDeletionCacheExpiration = 1 * time.Minute
-	// retryPeriodForRecentlyDeletedObject is the time to wait before retrying enqueuing a key that was just deleted but still present in the informer store
-	retryPeriodForRecentlyDeletedObject = 10 * time.Second
+	// defaultStaleObjectExpiration configures the duration for keeping a history of recently deleted object UIDs and of the resourceVersions written by handlers
+	defaultStaleObjectExpiration = 1 * time.Minute
+	// defaultStaleObjectRetryPeriod is the time to wait before retrying enqueuing a key whose object in the informer store is older than the last handler execution
+	defaultStaleObjectRetryPeriod = 10 * time.Second
 )
 
 var (
@@ -33,27 +33,42 @@ type handlerEntry struct {
 	handler SharedControllerHandler
 }
 
+type batchHandlerEntry struct {
+	id      int64
+	name    string
+	handler BatchHandler
+}
+
 type SharedHandler struct {
 	// Used for metrics recording
 	// They are exported because this SharedHandler is sometimes embedded used as a field in other packages, like dynamic
 	ControllerName string
 	CtxID          string
 
-	// keep first because arm32 needs atomic.AddInt64 target to be mem aligned
+	// keep first because arm32 needs atomic.AddInt64 target to be mem aligned. Only the two strings above, 16 bytes on
+	// 32-bit targets, may come before it: add new fields below.
 	idCounter int64
 
+	// Expectations, if set, defers the keys whose expected writes were not observed yet
+	Expectations *Expectations
+	// StaleObjectExpiration is how long the objects finalized and the resourceVersions written by the handlers are
+	// remembered, in order to requeue keys whose cached object is older. Defaults to 1 minute.
+	StaleObjectExpiration time.Duration
+	// StaleObjectRetryPeriod is how long to wait before retrying a key whose cached object is stale, defaults to 10 seconds
+	StaleObjectRetryPeriod time.Duration
+
 	lock            sync.RWMutex
 	handlers        []handlerEntry
+	batchHandlers   []batchHandlerEntry
 	recentDeletions *cache.Expiring
+	lastWritten     *cache.Expiring
 }
 
 func (h *SharedHandler) Register(ctx context.Context, name string, handler SharedControllerHandler) {
 	h.lock.Lock()
 	defer h.lock.Unlock()
 
-	if h.recentDeletions == nil {
-		h.recentDeletions = cache.NewExpiring()
-	}
+	h.initStaleObjectGuard()
 
 	id := atomic.AddInt64(&h.idCounter, 1)
 	h.handlers = append(h.handlers, handlerEntry{
@@ -77,19 +92,109 @@ func (h *SharedHandler) Register(ctx context.Context, name string, handler Share
 	}()
 }
 
+// RegisterBatch adds a handler called with every batch of keys, after the handlers added through Register processed them
+func (h *SharedHandler) RegisterBatch(ctx context.Context, name string, handler BatchHandler) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.initStaleObjectGuard()
+
+	id := atomic.AddInt64(&h.idCounter, 1)
+	h.batchHandlers = append(h.batchHandlers, batchHandlerEntry{
+		id:      id,
+		name:    name,
+		handler: handler,
+	})
+
+	go func() {
+		<-ctx.Done()
+
+		h.lock.Lock()
+		defer h.lock.Unlock()
+
+		for i := range h.batchHandlers {
+			if h.batchHandlers[i].id == id {
+				h.batchHandlers = append(h.batchHandlers[:i], h.batchHandlers[i+1:]...)
+				break
+			}
+		}
+	}()
+}
+
 func (h *SharedHandler) OnChange(key string, obj runtime.Object) error {
-	// early skip for a special case: objects that were just deleted but still not updated in the informer cache.
-	// modifications performed by early chained handlers also cause a new enqueue of the processed key, while later late handlers modifications
-	// could cause the definitive deletion of the object (by removing a finalizer). If this happens fast enough, it creates a race condition where handlers receive an out-of-date version of the object.
-	// See https://github.com/rancher/rancher/issues/49328 for more details.
-	if obj != nil && h.deletedInPreviousExecution(obj) {
-		return &retryAfterError{duration: retryPeriodForRecentlyDeletedObject}
-	}
+	return h.OnChanges([]BatchItem{{Key: key, Object: obj}})[key]
+}
 
+// OnChanges runs the handlers on every item, then the batch handlers on all the items at once
+func (h *SharedHandler) OnChanges(items []BatchItem) map[string]error {
 	h.lock.RLock()
 	handlers := h.handlers
+	batchHandlers := h.batchHandlers
 	h.lock.RUnlock()
 
+	results := map[string]error{}
+	errs := map[string]errorList{}
+	handled := make([]BatchItem, 0, len(items))
+	for _, item := range items {
+		// early skip for objects that were modified by a previous execution but still not updated in the informer cache.
+		// modifications performed by early chained handlers also cause a new enqueue of the processed key, while later late handlers modifications
+		// could cause the definitive deletion of the object (by removing a finalizer). If this happens fast enough, it creates a race condition where handlers receive an out-of-date version of the object.
+		// See https://github.com/rancher/rancher/issues/49328 for more details.
+		if reason, stale := h.isStale(item.Object); stale {
+			metrics.IncStaleObjectRequeues(h.CtxID, h.ControllerName, reason)
+			results[item.Key] = &retryAfterError{duration: h.staleObjectRetryPeriod()}
+			continue
+		}
+		if h.Expectations != nil {
+			if item.Object == nil {
+				h.Expectations.Delete(item.Key)
+			} else if satisfied, remaining := h.Expectations.Satisfied(item.Key, item.Object); !satisfied {
+				// the key is enqueued again as soon as the expectations are observed
+				results[item.Key] = &retryAfterError{duration: remaining}
+				continue
+			}
+		}
+
+		obj, itemErrs := h.runHandlers(handlers, item.Key, item.Object)
+		h.observeWrite(item.Object, obj)
+		errs[item.Key] = itemErrs
+		handled = append(handled, BatchItem{Key: item.Key, Object: obj})
+	}
+
+	if len(handled) > 0 {
+		for _, handler := range batchHandlers {
+			var hasError bool
+			reconcileStartTS := time.Now()
+
+			for key, err := range handler.handler.OnChanges(handled) {
+				if _, ok := errs[key]; !ok || err == nil || errors.Is(err, ErrIgnore) {
+					continue
+				}
+				errs[key] = append(errs[key], &handlerError{
+					HandlerName: handler.name,
+					Err:         err,
+				})
+				hasError = true
+			}
+			metrics.IncTotalHandlerExecutions(h.CtxID, h.ControllerName, handler.name, hasError)
+			reconcileTime := time.Since(reconcileStartTS)
+			metrics.ReportReconcileTime(h.CtxID, h.ControllerName, handler.name, hasError, reconcileTime.Seconds())
+		}
+	}
+
+	for _, item := range handled {
+		if item.Object != nil && wasFinalized(item.Object) {
+			h.observeDeletedObjectAfterFinalize(item.Object)
+		}
+		if err := errs[item.Key].ToErr(); err != nil {
+			results[item.Key] = err
+		}
+	}
+	return results
+}
+
+// runHandlers calls the handlers in order, each of them receiving the object returned by the previous one
+func (h *SharedHandler) runHandlers(handlers []handlerEntry, key string, obj runtime.Object) (runtime.Object, errorList) {
 	var errs errorList
 	for _, handler := range handlers {
 		var hasError bool
@@ -118,12 +223,90 @@ func (h *SharedHandler) OnChange(key string, obj runtime.Object) error {
 			}
 		}
 	}
+	return obj, errs
+}
+
+// initStaleObjectGuard must be called while holding the lock
+func (h *SharedHandler) initStaleObjectGuard() {
+	if h.recentDeletions == nil {
+		h.recentDeletions = cache.NewExpiring()
+	}
+	if h.lastWritten == nil {
+		h.lastWritten = cache.NewExpiring()
+	}
+}
+
+func (h *SharedHandler) staleObjectExpiration() time.Duration {
+	if h.StaleObjectExpiration > 0 {
+		return h.StaleObjectExpiration
+	}
+	return defaultStaleObjectExpiration
+}
+
+func (h *SharedHandler) staleObjectRetryPeriod() time.Duration {
+	if h.StaleObjectRetryPeriod > 0 {
+		return h.StaleObjectRetryPeriod
+	}
+	return defaultStaleObjectRetryPeriod
+}
+
+// isStale returns whether the object is older than what previous executions of the handlers saw, and why
+func (h *SharedHandler) isStale(obj runtime.Object) (string, bool) {
+	if obj == nil {
+		return "", false
+	}
+	if h.deletedInPreviousExecution(obj) {
+		return "deleted", true
+	}
+	if h.olderThanLastWrite(obj) {
+		return "outdated", true
+	}
+	return "", false
+}
+
+// observeWrite remembers the resourceVersion of the object returned by the handlers, if they updated it
+func (h *SharedHandler) observeWrite(original, written runtime.Object) {
+	// Corner-case: Register was never called, so lastWritten was not initialized
+	if h.lastWritten == nil || original == nil || written == nil || original == written {
+		return
+	}
+
+	originalMeta, err := meta.Accessor(original)
+	if err != nil {
+		return
+	}
+	writtenMeta, err := meta.Accessor(written)
+	if err != nil {
+		return
+	}
+	if writtenMeta.GetUID() != originalMeta.GetUID() || writtenMeta.GetResourceVersion() == "" ||
+		writtenMeta.GetResourceVersion() == originalMeta.GetResourceVersion() {
+		return
+	}
+	h.lastWritten.Set(writtenMeta.GetUID(), writtenMeta.GetResourceVersion(), h.staleObjectExpiration())
+}
 
-	if obj != nil && wasFinalized(obj) {
-		h.observeDeletedObjectAfterFinalize(obj)
+// olderThanLastWrite returns whether the object is older than the last version written by the handlers
+func (h *SharedHandler) olderThanLastWrite(obj runtime.Object) bool {
+	// Corner-case: Register was never called, so lastWritten was not initialized
+	if h.lastWritten == nil {
+		return false
 	}
 
-	return errs.ToErr()
+	meta, err := meta.Accessor(obj)
+	if err != nil {
+		return false
+	}
+	written, ok := h.lastWritten.Get(meta.GetUID())
+	if !ok {
+		return false
+	}
+	if resourceVersionObserved(obj, written.(string)) {
+		// the cache caught up, there is no need to remember the write anymore
+		h.lastWritten.Delete(meta.GetUID())
+		return false
+	}
+	return true
 }
 
 // wasFinalized determines if an object which initially had finalizers got them removed, hence unblocking its erasure by Kubernetes
@@ -148,7 +331,7 @@ func (h *SharedHandler) observeDeletedObjectAfterFinalize(obj runtime.Object) {
 	if err != nil {
 		return
 	}
-	h.recentDeletions.Set(meta.GetUID(), struct{}{}, recentDeletionCacheExpiration)
+	h.recentDeletions.Set(meta.GetUID(), struct{}{}, h.staleObjectExpiration())
 }
 
 // deletedInPreviousExecution returns whether an object has been deleted in earlier executions of the controller.
@@ -197,6 +380,10 @@ func (e errorList) ToErr() error {
 	}
 }
 
+func (e errorList) Unwrap() []error {
+	return e
+}
+
 func (e errorList) Cause() error {
 	if len(e) > 0 {
 		return e[0]
@@ -216,3 +403,7 @@ func (h handlerError) Error() string {
 func (h handlerError) Cause() error {
 	return h.Err
 }
+
+func (h handlerError) Unwrap() error {
+	return h.Err
+}
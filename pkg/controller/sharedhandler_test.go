@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestSharedHandler_idCounterAlignment(t *testing.T) {
+	t.Parallel()
+
+	var h SharedHandler
+	// atomic.AddInt64 panics on 32-bit targets unless idCounter is 8-byte aligned, which only holds while it follows
+	// the two strings opening the struct
+	assert.Equal(t, unsafe.Offsetof(h.CtxID)+unsafe.Sizeof(h.CtxID), unsafe.Offsetof(h.idCounter))
+	assert.Zero(t, unsafe.Offsetof(h.idCounter)%8)
+}
+
+func TestSharedHandler_staleObject(t *testing.T) {
+	t.Parallel()
+
+	handler := &SharedHandler{StaleObjectRetryPeriod: time.Second}
+	var seen []string
+	handler.Register(t.Context(), "test", SharedControllerHandlerFunc(func(_ string, obj runtime.Object) (runtime.Object, error) {
+		cm := obj.(*corev1.ConfigMap)
+		seen = append(seen, cm.ResourceVersion)
+		// simulate an update
+		cm = cm.DeepCopy()
+		cm.ResourceVersion = "2"
+		return cm, nil
+	}))
+	newConfigMap := func(resourceVersion string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "cm", UID: "uid", ResourceVersion: resourceVersion}}
+	}
+
+	assert.NoError(t, handler.OnChange("ns/cm", newConfigMap("1")))
+
+	// the cache did not observe the update yet
+	err := handler.OnChange("ns/cm", newConfigMap("1"))
+	var retryAfter *retryAfterError
+	if assert.ErrorAs(t, err, &retryAfter) {
+		assert.Equal(t, time.Second, retryAfter.duration)
+	}
+	assert.Equal(t, []string{"1"}, seen)
+
+	assert.NoError(t, handler.OnChange("ns/cm", newConfigMap("2")))
+	assert.Equal(t, []string{"1", "2"}, seen)
+}
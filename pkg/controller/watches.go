@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rancher/lasso/pkg/log"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+// MapFunc returns the keys of the primary objects to enqueue when the given secondary object changes
+type MapFunc func(obj runtime.Object) ([]string, error)
+
+func (s *sharedController) Watches(ctx context.Context, gvk schema.GroupVersionKind, mapFunc MapFunc) error {
+	if s.controllerForKind == nil {
+		return fmt.Errorf("shared controller was not created from a SharedControllerFactory")
+	}
+	secondary, err := s.controllerForKind(gvk)
+	if err != nil {
+		return err
+	}
+
+	informer := secondary.Informer()
+	registration, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			s.enqueueMapped(gvk, mapFunc, obj)
+		},
+		UpdateFunc: func(old, new interface{}) {
+			// the old object is mapped too, so primaries no longer matching the secondary are reconciled as well
+			s.enqueueMapped(gvk, mapFunc, old, new)
+		},
+		DeleteFunc: func(obj interface{}) {
+			s.enqueueMapped(gvk, mapFunc, obj)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		if err := informer.RemoveEventHandler(registration); err != nil {
+			log.Errorf("error removing %s watch event handler: %v", gvk, err)
+		}
+	}()
+	return nil
+}
+
+func (s *sharedController) enqueueMapped(gvk schema.GroupVersionKind, mapFunc MapFunc, objs ...interface{}) {
+	seen := map[string]struct{}{}
+	for _, obj := range objs {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		runtimeObj, ok := obj.(runtime.Object)
+		if !ok {
+			continue
+		}
+
+		keys, err := mapFunc(runtimeObj)
+		if err != nil {
+			log.Errorf("error mapping %s to primary keys: %v", gvk, err)
+			continue
+		}
+		for _, key := range keys {
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			s.EnqueueKey(key)
+		}
+	}
+}
+
+// MapOwners returns a MapFunc enqueuing the owners of the given GroupVersionKind of a secondary object. The version of
+// the owner reference is ignored.
+func MapOwners(owner schema.GroupVersionKind, namespaced bool) MapFunc {
+	return func(obj runtime.Object) ([]string, error) {
+		m, err := meta.Accessor(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		var keys []string
+		for _, ref := range m.GetOwnerReferences() {
+			gv, err := schema.ParseGroupVersion(ref.APIVersion)
+			if err != nil || gv.Group != owner.Group || ref.Kind != owner.Kind {
+				continue
+			}
+			if namespaced {
+				keys = append(keys, m.GetNamespace()+"/"+ref.Name)
+			} else {
+				keys = append(keys, ref.Name)
+			}
+		}
+		return keys, nil
+	}
+}
+
+// SelectorFunc returns the label selector of a primary object, nil meaning it selects nothing
+type SelectorFunc func(primary runtime.Object) (labels.Selector, error)
+
+// MapSelector returns a MapFunc enqueuing the cached primary objects whose label selector matches the secondary
+// object. Namespaced primary objects only select secondary objects of their own namespace.
+func MapSelector(primary SharedController, selectorFunc SelectorFunc) MapFunc {
+	return func(obj runtime.Object) ([]string, error) {
+		m, err := meta.Accessor(obj)
+		if err != nil {
+			return nil, err
+		}
+		objLabels := labels.Set(m.GetLabels())
+
+		var keys []string
+		for _, p := range primary.Informer().GetStore().List() {
+			primaryObj, ok := p.(runtime.Object)
+			if !ok {
+				continue
+			}
+			primaryMeta, err := meta.Accessor(primaryObj)
+			if err != nil {
+				return nil, err
+			}
+			if primaryMeta.GetNamespace() != "" && primaryMeta.GetNamespace() != m.GetNamespace() {
+				continue
+			}
+
+			selector, err := selectorFunc(primaryObj)
+			if err != nil {
+				return nil, err
+			}
+			if selector == nil || !selector.Matches(objLabels) {
+				continue
+			}
+
+			key, err := cache.MetaNamespaceKeyFunc(primaryObj)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		}
+		return keys, nil
+	}
+}
+
+// MapIndex returns a MapFunc enqueuing the primary objects found in the given index of the primary cache, using the
+// values computed from the secondary object.
+func MapIndex(primary SharedController, indexName string, indexValues func(obj runtime.Object) ([]string, error)) MapFunc {
+	return func(obj runtime.Object) ([]string, error) {
+		values, err := indexValues(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		var keys []string
+		for _, value := range values {
+			indexKeys, err := primary.Informer().GetIndexer().IndexKeys(indexName, value)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, indexKeys...)
+		}
+		return keys, nil
+	}
+}
@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestSharedController_enqueueMapped(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	primary := NewMockSharedController(ctrl)
+	s := &sharedController{
+		deferredController: func() (Controller, error) {
+			return primary, nil
+		},
+	}
+
+	mapFunc := func(obj runtime.Object) ([]string, error) {
+		return []string{"ns/shared", "ns/" + obj.(*corev1.ConfigMap).Name}, nil
+	}
+	old := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "old"}}
+	updated := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "new"}}
+
+	// keys returned for both the old and new objects are only enqueued once
+	primary.EXPECT().EnqueueKey("ns/shared").Times(1)
+	primary.EXPECT().EnqueueKey("ns/old").Times(1)
+	primary.EXPECT().EnqueueKey("ns/new").Times(1)
+	s.enqueueMapped(corev1.SchemeGroupVersion.WithKind("ConfigMap"), mapFunc, old, cache.DeletedFinalStateUnknown{Obj: updated})
+}
+
+func TestMapOwners(t *testing.T) {
+	t.Parallel()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "ns",
+			Name:      "pod",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "rs"},
+				{APIVersion: "v1", Kind: "ReplicaSet", Name: "other-group"},
+				{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "sts"},
+			},
+		},
+	}
+
+	keys, err := MapOwners(appsv1.SchemeGroupVersion.WithKind("ReplicaSet"), true)(pod)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ns/rs"}, keys)
+
+	keys, err = MapOwners(appsv1.SchemeGroupVersion.WithKind("StatefulSet"), false)(pod)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sts"}, keys)
+}
+
+func TestMapSelectorAndIndex(t *testing.T) {
+	t.Parallel()
+
+	informer := cache.NewSharedIndexInformer(nil, &appsv1.Deployment{}, 0, cache.Indexers{
+		"configmaps": func(obj interface{}) ([]string, error) {
+			deployment := obj.(*appsv1.Deployment)
+			var names []string
+			for _, volume := range deployment.Spec.Template.Spec.Volumes {
+				if volume.ConfigMap != nil {
+					names = append(names, deployment.Namespace+"/"+volume.ConfigMap.Name)
+				}
+			}
+			return names, nil
+		},
+	})
+	ctrl := gomock.NewController(t)
+	primary := NewMockSharedController(ctrl)
+	primary.EXPECT().Informer().Return(informer).AnyTimes()
+
+	newDeployment := func(namespace, name, app, configMap string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec: appsv1.DeploymentSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": app}},
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Volumes: []corev1.Volume{{
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{Name: configMap},
+								},
+							},
+						}},
+					},
+				},
+			},
+		}
+	}
+	require.NoError(t, informer.GetStore().Add(newDeployment("ns", "web", "web", "config")))
+	require.NoError(t, informer.GetStore().Add(newDeployment("ns", "db", "db", "other")))
+	require.NoError(t, informer.GetStore().Add(newDeployment("other-ns", "web", "web", "config")))
+
+	selector := MapSelector(primary, func(obj runtime.Object) (labels.Selector, error) {
+		return metav1.LabelSelectorAsSelector(obj.(*appsv1.Deployment).Spec.Selector)
+	})
+	keys, err := selector(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod", Labels: map[string]string{"app": "web"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ns/web"}, keys)
+
+	index := MapIndex(primary, "configmaps", func(obj runtime.Object) ([]string, error) {
+		key, err := cache.MetaNamespaceKeyFunc(obj)
+		return []string{key}, err
+	})
+	keys, err = index(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "config"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ns/web"}, keys)
+}
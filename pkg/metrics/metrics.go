@@ -15,11 +15,18 @@ const (
 	controllerNameLabel = "controller_name"
 	handlerNameLabel    = "handler_name"
 	hasErrorLabel       = "has_error"
+	partitionLabel      = "partition"
+	reasonLabel         = "reason"
 
 	contextLabel = "ctx"
 	groupLabel   = "group"
 	versionLabel = "version"
 	kindLabel    = "kind"
+
+	lassoClientSubsystem = "lasso_client"
+	resourceLabel        = "resource"
+	verbLabel            = "verb"
+	codeLabel            = "code"
 )
 
 type contextIDKey struct{}
@@ -63,6 +70,65 @@ var (
 		Name:      "reconcile_time_seconds",
 		Help:      "Histogram of the durations per reconciliation per controller",
 	}, []string{contextLabel, controllerNameLabel, handlerNameLabel, hasErrorLabel})
+
+	// queuePartitionDepth exposes how many keys are waiting in each partition of a fair queue
+	queuePartitionDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: lassoSubsystem,
+		Name:      "queue_partition_depth",
+		Help:      "Current depth of each partition of a fair workqueue",
+	}, []string{controllerNameLabel, partitionLabel})
+
+	// concurrencyWaitTime exposes how long keys wait for a ConcurrencyLimiter once dequeued
+	concurrencyWaitTime = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Subsystem: lassoSubsystem,
+		Name:      "concurrency_wait_seconds",
+		Help:      "Histogram of the time spent waiting for the concurrency budget before reconciling a key",
+	}, []string{contextLabel, controllerNameLabel})
+
+	// adaptiveConcurrencyLimit exposes the current limit of controllers using adaptive concurrency
+	adaptiveConcurrencyLimit = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: lassoSubsystem,
+		Name:      "adaptive_concurrency_limit",
+		Help:      "Current number of keys a controller using adaptive concurrency can reconcile at once",
+	}, []string{contextLabel, controllerNameLabel})
+
+	// staleObjectRequeues counts the reconciles skipped because the cache did not observe the previous writes yet
+	staleObjectRequeues = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: lassoSubsystem,
+		Name:      "stale_object_requeues_total",
+		Help:      "Total count of keys requeued instead of running handlers on a cached object older than their last write",
+	}, []string{contextLabel, controllerNameLabel, reasonLabel})
+
+	// clientRequests counts the API requests sent by clients, code being the HTTP status code of the response
+	clientRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: lassoClientSubsystem,
+		Name:      "requests_total",
+		Help:      "Total count of API requests sent by clients",
+	}, []string{contextLabel, groupLabel, versionLabel, resourceLabel, verbLabel, codeLabel})
+
+	// clientRequestDuration exposes the latency of the API requests sent by clients, until a watch was established for
+	// watch requests
+	clientRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Subsystem: lassoClientSubsystem,
+		Name:      "request_duration_seconds",
+		Help:      "Histogram of the latencies of the API requests sent by clients",
+	}, []string{contextLabel, groupLabel, versionLabel, resourceLabel, verbLabel, codeLabel})
+
+	// clientWatchDuration exposes how long the watches of clients lasted, from 1 second to about an hour
+	clientWatchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Subsystem: lassoClientSubsystem,
+		Name:      "watch_duration_seconds",
+		Help:      "Histogram of the durations of the watches of clients",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{contextLabel, groupLabel, versionLabel, resourceLabel})
+
+	// clientThrottleDuration exposes how long the requests of clients waited for the rate limits of their resources
+	clientThrottleDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Subsystem: lassoClientSubsystem,
+		Name:      "throttle_duration_seconds",
+		Help:      "Histogram of the time the requests of clients waited for the rate limits of their resources",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{contextLabel, groupLabel, versionLabel, resourceLabel})
 )
 
 func IncTotalHandlerExecutions(ctxID, controllerName, handlerName string, hasError bool) {
@@ -118,3 +184,109 @@ func ReportReconcileTime(ctxID, controllerName, handlerName string, hasError boo
 		).Observe(observeTime)
 	}
 }
+
+// SetQueuePartitionDepth sets the number of keys waiting in a partition of the named controller's queue
+func SetQueuePartitionDepth(controllerName, partition string, depth int) {
+	if prometheusMetrics {
+		queuePartitionDepth.With(
+			prometheus.Labels{
+				controllerNameLabel: controllerName,
+				partitionLabel:      partition,
+			},
+		).Set(float64(depth))
+	}
+}
+
+// DelQueuePartitionDepth deletes the depth metric of a partition that no longer holds any key
+func DelQueuePartitionDepth(controllerName, partition string) {
+	if prometheusMetrics {
+		queuePartitionDepth.Delete(
+			prometheus.Labels{
+				controllerNameLabel: controllerName,
+				partitionLabel:      partition,
+			},
+		)
+	}
+}
+
+// ReportConcurrencyWaitTime observes the time a controller waited for its concurrency budget before reconciling a key
+func ReportConcurrencyWaitTime(ctxID, controllerName string, observeTime float64) {
+	if prometheusMetrics {
+		concurrencyWaitTime.With(
+			prometheus.Labels{
+				contextLabel:        ctxID,
+				controllerNameLabel: controllerName,
+			},
+		).Observe(observeTime)
+	}
+}
+
+// SetAdaptiveConcurrencyLimit sets the current concurrency limit of a controller using adaptive concurrency
+func SetAdaptiveConcurrencyLimit(ctxID, controllerName string, limit int) {
+	if prometheusMetrics {
+		adaptiveConcurrencyLimit.With(
+			prometheus.Labels{
+				contextLabel:        ctxID,
+				controllerNameLabel: controllerName,
+			},
+		).Set(float64(limit))
+	}
+}
+
+// IncStaleObjectRequeues counts a key requeued because its cached object was stale, reason being either "deleted" or
+// "outdated"
+func IncStaleObjectRequeues(ctxID, controllerName, reason string) {
+	if prometheusMetrics {
+		staleObjectRequeues.With(
+			prometheus.Labels{
+				contextLabel:        ctxID,
+				controllerNameLabel: controllerName,
+				reasonLabel:         reason,
+			},
+		).Inc()
+	}
+}
+
+// ReportClientRequest counts an API request sent by a client and observes its latency
+func ReportClientRequest(ctxID string, gvr schema.GroupVersionResource, verb, code string, observeTime float64) {
+	if prometheusMetrics {
+		labels := prometheus.Labels{
+			contextLabel:  ctxID,
+			groupLabel:    gvr.Group,
+			versionLabel:  gvr.Version,
+			resourceLabel: gvr.Resource,
+			verbLabel:     verb,
+			codeLabel:     code,
+		}
+		clientRequests.With(labels).Inc()
+		clientRequestDuration.With(labels).Observe(observeTime)
+	}
+}
+
+// ReportClientWatchDuration observes how long a watch of a client lasted
+func ReportClientWatchDuration(ctxID string, gvr schema.GroupVersionResource, observeTime float64) {
+	if prometheusMetrics {
+		clientWatchDuration.With(
+			prometheus.Labels{
+				contextLabel:  ctxID,
+				groupLabel:    gvr.Group,
+				versionLabel:  gvr.Version,
+				resourceLabel: gvr.Resource,
+			},
+		).Observe(observeTime)
+	}
+}
+
+// ReportClientThrottleDuration observes how long a request of a client waited for the rate limit of its resource
+func ReportClientThrottleDuration(ctxID string, gvr schema.GroupVersionResource, observeTime float64) {
+	if prometheusMetrics {
+		clientThrottleDuration.With(
+			prometheus.Labels{
+				contextLabel:  ctxID,
+				groupLabel:    gvr.Group,
+				versionLabel:  gvr.Version,
+				resourceLabel: gvr.Resource,
+			},
+		).Observe(observeTime)
+	}
+}
@@ -28,6 +28,14 @@ func MustRegisterWithWorkqueue(registerer prometheus.Registerer) {
 		TotalControllerExecutions,
 		TotalCachedObjects,
 		reconcileTime,
+		queuePartitionDepth,
+		concurrencyWaitTime,
+		adaptiveConcurrencyLimit,
+		staleObjectRequeues,
+		clientRequests,
+		clientRequestDuration,
+		clientWatchDuration,
+		clientThrottleDuration,
 		// expose workqueue metrics
 		depth,
 		adds,
@@ -50,5 +58,13 @@ func MustRegister(registerer prometheus.Registerer) {
 		TotalControllerExecutions,
 		TotalCachedObjects,
 		reconcileTime,
+		queuePartitionDepth,
+		concurrencyWaitTime,
+		adaptiveConcurrencyLimit,
+		staleObjectRequeues,
+		clientRequests,
+		clientRequestDuration,
+		clientWatchDuration,
+		clientThrottleDuration,
 	)
 }